@@ -3,6 +3,8 @@ package dbx
 // 缓存模块
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -17,16 +19,72 @@ import (
 type ICache interface {
 	// Has 检查键是否存在
 	Has(ctx context.Context, key string) bool
-	// Get 获取值
+	// Get 获取值，键不存在或已过期时返回ErrCacheMiss，存入nil时返回JNull
 	Get(ctx context.Context, key string) (jsonx.JValue, error)
-	// Set 设置值
-	Set(ctx context.Context, key string, value any) error
-	// SetEx 设置带过期时间的值
-	SetEx(ctx context.Context, key string, value any, expiration time.Duration) error
+	// Set 设置值，可用WithTags打标签
+	Set(ctx context.Context, key string, value any, opts ...SetOpt) error
+	// SetEx 设置带过期时间的值，expiration<=0表示不过期，可用WithTags打标签
+	SetEx(ctx context.Context, key string, value any, expiration time.Duration, opts ...SetOpt) error
+	// SetNX 键不存在时设置值，expiration<=0表示不过期；返回是否设置成功
+	SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error)
+	// Del 删除键，返回实际删除的个数
+	Del(ctx context.Context, keys ...string) (int64, error)
+	// Expire 重设过期时间，expiration<=0表示移除过期时间；键不存在时返回false
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
+	// TTL 剩余过期时间，不过期时返回NoExpiration；键不存在时返回ErrCacheMiss
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Incr 原子加1，见IncrBy
+	Incr(ctx context.Context, key string) (int64, error)
+	// IncrBy 原子增加n并返回新值；键不存在时从0开始，保留原过期时间，值非整数时返回错误
+	IncrBy(ctx context.Context, key string, n int64) (int64, error)
+	// MGet 批量获取，结果中不含不存在的键
+	MGet(ctx context.Context, keys ...string) (map[string]jsonx.JValue, error)
+	// MSet 批量设置，expiration<=0表示不过期
+	MSet(ctx context.Context, values map[string]any, expiration time.Duration) error
+	// InvalidateTags 删除带有任一标签的键，返回实际删除的个数
+	InvalidateTags(ctx context.Context, tags ...string) (int64, error)
+	// Scan 遍历匹配pattern的键(glob语法: * ? [a-z] \转义)；fn返回ErrStopEach时提前结束
+	Scan(ctx context.Context, pattern string, fn func(key string) error) error
 	// Close 关闭缓存连接
 	Close(ctx context.Context) error
 }
 
+// NoExpiration TTL返回值，表示键不过期
+const NoExpiration time.Duration = -1
+
+// ErrCacheMiss 键不存在或已过期，可用errors.Is判断
+var ErrCacheMiss = errors.New("dbx: cache miss")
+
+// ErrCacheClosed 缓存已关闭
+var ErrCacheClosed = errors.New("dbx: cache closed")
+
+// setOpts Set/SetEx选项
+type setOpts struct {
+	tags []string
+}
+
+// SetOpt Set/SetEx选项
+type SetOpt func(*setOpts)
+
+// WithTags 写入时打标签，之后可用InvalidateTags按标签批量删除
+func WithTags(tags ...string) SetOpt {
+	return func(o *setOpts) { o.tags = append(o.tags, tags...) }
+}
+
+// applySetOpts 合并选项
+func applySetOpts(opts []SetOpt) *setOpts {
+	o := &setOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// cacheMiss 带键名的ErrCacheMiss
+func cacheMiss(key string) error {
+	return fmt.Errorf("key %s: %w", key, ErrCacheMiss)
+}
+
 // CacheMgr 缓存管理器
 type CacheMgr struct {
 	cacheMap map[string]ICache
@@ -56,22 +114,29 @@ type CacheConf = jsonx.JObj
 func (cm *CacheMgr) Init(ctx context.Context, caches map[string]CacheConf) error {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
-	var err error
 
 	for name, conf := range caches {
 		cacheType := getOrDefault(&conf, "type", "mem")
 
 		var cache ICache
+		var err error
 
 		switch cacheType {
 		case "mem":
 			cache = NewMemCache(ctx, conf)
 		case "redis":
 			cache, err = NewRedisCache(ctx, conf)
+		case "tiered":
+			cache, err = NewTieredCache(ctx, conf)
+		case "file":
+			cache, err = NewFileCache(ctx, conf)
 		default:
-			cache = NewMemCache(ctx, conf)
 			err = errors.New("type not supported")
 		}
+		if err != nil {
+			// 构造失败时返回的是带类型的nil指针，需显式置空才能走降级
+			cache = nil
+		}
 		if cache == nil {
 			conf.Put("mode", "mem")
 			logx.WarnfM(ctx, "CacheMgr", "use mem instead; name:%v type:%s created failed: %v ", name, cacheType, err)
@@ -115,6 +180,22 @@ func (cm *CacheMgr) CloseAll(ctx context.Context) {
 	cm.cacheMap = make(map[string]ICache)
 }
 
+// InvalidateTags 在所有缓存中删除带有任一标签的键
+func (cm *CacheMgr) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	var total int64
+	var errs []error
+	for name, cache := range cm.cacheMap {
+		n, err := cache.InvalidateTags(ctx, tags...)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cache %s: %w", name, err))
+		}
+	}
+	return total, stderrors.Join(errs...)
+}
+
 // 导出的全局函数
 
 // InitCache 初始化全局缓存
@@ -127,6 +208,11 @@ func UseCache(name string) (ICache, error) {
 	return CacheX().Use(name)
 }
 
+// InvalidateTags 在所有全局缓存中按标签删除键
+func InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	return CacheX().InvalidateTags(ctx, tags...)
+}
+
 // CloseCaches 关闭所有全局缓存
 func CloseCaches(ctx context.Context) {
 	CacheX().CloseAll(ctx)
@@ -0,0 +1,682 @@
+package dbx
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+)
+
+// fileTmpSuffix 写入中的临时文件后缀，临时文件名为"<目标文件名>.<随机数>.tmp"，启动时清理
+const fileTmpSuffix = ".tmp"
+
+// fileLockName 目录锁文件名，持有期间其他实例无法打开同一目录
+const fileLockName = ".lock"
+
+// FileCache 本地磁盘缓存，重启后数据仍在；每个键一个文件，内容为元数据行+值。
+// 写入先写临时文件再rename，崩溃后不会留下半个文件；校验和不符的文件在读取时丢弃。
+// 超出max_bytes时按最近访问淘汰(重启后按写入时间)。同一目录只能由一个实例使用，打开时独占目录下的锁文件
+type FileCache struct {
+	dir       string
+	maxBytes  int64
+	codec     *valueCodec
+	entries   map[string]*list.Element // 键 -> lru节点
+	lru       *list.List               // 队首为最近访问，元素为*fileEntry
+	bytes     int64
+	tags      map[string]map[string]struct{}
+	stats     cacheCounters
+	cancel    context.CancelFunc
+	cleanSecs int
+	lockFile  *os.File // 目录锁，Close时释放并置空
+
+	sync.Mutex
+}
+
+// fileEntry 内存中的索引项
+type fileEntry struct {
+	key        string
+	path       string
+	size       int64
+	expiration int64
+	tags       []string
+}
+
+// fileMeta 文件首行的元数据
+type fileMeta struct {
+	Key  string   `json:"k"`
+	Exp  int64    `json:"e,omitempty"`
+	Tags []string `json:"t,omitempty"`
+	CRC  uint32   `json:"c"` // 值的crc32
+}
+
+// NewFileCache 创建磁盘缓存，扫描目录恢复索引；配置dir(默认系统临时目录下dbx-cache)、max_bytes(默认256MB)、clean_sec
+func NewFileCache(ctx context.Context, conf CacheConf) (*FileCache, error) {
+	codec, err := newValueCodec(conf)
+	if err != nil {
+		return nil, err
+	}
+	dir := getOrDefault(&conf, "dir", filepath.Join(os.TempDir(), "dbx-cache"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("file cache dir %s: %w", dir, err)
+	}
+	lockFile, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &FileCache{
+		dir:       dir,
+		maxBytes:  int64(getIntOr(&conf, "max_bytes", 256<<20)),
+		codec:     codec,
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		tags:      map[string]map[string]struct{}{},
+		cancel:    cancel,
+		cleanSecs: getIntOr(&conf, "clean_sec", 300),
+		lockFile:  lockFile,
+	}
+	if err := c.restore(ctx); err != nil {
+		cancel()
+		lockFile.Close()
+		return nil, err
+	}
+	go c.cleanup(ctx)
+	return c, nil
+}
+
+// restore 扫描目录重建索引：删除临时文件、元数据损坏与已过期的文件；
+// 只处理符合缓存布局的文件，目录中的其他文件与子目录原样保留
+func (c *FileCache) restore(ctx context.Context) error {
+	type found struct {
+		entry *fileEntry
+		mtime time.Time
+	}
+	var all []found
+	now := time.Now().UnixNano()
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(c.dir, path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			// 只进入两位hex的子目录
+			if rel != "." && (len(parts) > 1 || !isHex(parts[0], 2)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(parts) != 2 {
+			return nil
+		}
+		switch cacheFileKind(parts[0], parts[1]) {
+		case fileKindTmp:
+			return os.Remove(path)
+		case fileKindOther:
+			return nil
+		}
+		entry, mtime, err := readFileEntry(path)
+		if err != nil || entry.path != c.path(entry.key) || (entry.expiration > 0 && entry.expiration < now) {
+			if err != nil {
+				logx.WarnfM(ctx, "CacheMgr", "file cache drop %s: %v", path, err)
+			}
+			return os.Remove(path)
+		}
+		all = append(all, found{entry, mtime})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("file cache recover %s: %w", c.dir, err)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].mtime.Before(all[j].mtime) })
+	for _, f := range all {
+		c.entries[f.entry.key] = c.lru.PushFront(f.entry)
+		c.bytes += f.entry.size
+		c.addTags(f.entry.key, f.entry.tags)
+	}
+	// max_bytes可能调小过
+	c.evict()
+	return nil
+}
+
+// 缓存目录中的文件类别
+const (
+	fileKindOther = iota // 不属于缓存，不做处理
+	fileKindEntry        // <2位hex>/<32位hex>
+	fileKindTmp          // <2位hex>/<32位hex>.*.tmp
+)
+
+// cacheFileKind 按path写入的布局识别子目录sub中的文件name
+func cacheFileKind(sub, name string) int {
+	if len(name) < 32 || !isHex(name[:32], 32) || name[:2] != sub {
+		return fileKindOther
+	}
+	if len(name) == 32 {
+		return fileKindEntry
+	}
+	if name[32] == '.' && strings.HasSuffix(name, fileTmpSuffix) {
+		return fileKindTmp
+	}
+	return fileKindOther
+}
+
+// isHex 是否为n位小写十六进制
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, ch := range s {
+		if !(ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// readFileEntry 只读取元数据行，值的校验留到读取时
+func readFileEntry(path string) (*fileEntry, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("read meta: %w", err)
+	}
+	var meta fileMeta
+	if err := json.Unmarshal(line, &meta); err != nil {
+		return nil, time.Time{}, fmt.Errorf("parse meta: %w", err)
+	}
+	return &fileEntry{key: meta.Key, path: path, size: info.Size(), expiration: meta.Exp, tags: meta.Tags}, info.ModTime(), nil
+}
+
+// path 键对应的文件路径，按哈希前两位分目录
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:16])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// load 取未过期的索引项，过期项顺带删除；调用方需持有锁
+func (c *FileCache) load(key string) (*fileEntry, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*fileEntry)
+	if entry.expiration > 0 && entry.expiration < time.Now().UnixNano() {
+		c.remove(elem)
+		c.stats.expirations.Add(1)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// read 读取并校验值，文件丢失或损坏时删除索引；调用方需持有锁
+func (c *FileCache) read(key string) ([]byte, *fileEntry, bool) {
+	entry, ok := c.load(key)
+	if !ok {
+		return nil, nil, false
+	}
+	data, err := readFileValue(entry)
+	if err != nil {
+		logx.WarnfM(context.Background(), "CacheMgr", "file cache drop %s: %v", key, err)
+		c.remove(c.entries[key])
+		return nil, nil, false
+	}
+	return data, entry, true
+}
+
+// readFileValue 读取文件中的值并校验键与crc
+func readFileValue(entry *fileEntry) ([]byte, error) {
+	content, err := os.ReadFile(entry.path)
+	if err != nil {
+		return nil, err
+	}
+	line, data, ok := bytes.Cut(content, []byte{'\n'})
+	if !ok {
+		return nil, errors.New("missing meta")
+	}
+	var meta fileMeta
+	if err := json.Unmarshal(line, &meta); err != nil {
+		return nil, fmt.Errorf("parse meta: %w", err)
+	}
+	if meta.Key != entry.key || meta.CRC != crc32.ChecksumIEEE(data) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// write 原子写入文件并更新索引；覆盖时保留已有标签，与其他缓存一致。调用方需持有锁
+func (c *FileCache) write(key string, data []byte, expiration int64, tags []string) error {
+	if elem, ok := c.entries[key]; ok {
+		tags = mergeTags(elem.Value.(*fileEntry).tags, tags)
+	}
+	meta, err := json.Marshal(fileMeta{Key: key, Exp: expiration, Tags: tags, CRC: crc32.ChecksumIEEE(data)})
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+fileTmpSuffix)
+	if err != nil {
+		return err
+	}
+	content := append(append(meta, '\n'), data...)
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("file cache write %s: %w", key, err)
+	}
+
+	entry := &fileEntry{key: key, path: path, size: int64(len(content)), expiration: expiration, tags: tags}
+	if elem, ok := c.entries[key]; ok {
+		c.bytes -= elem.Value.(*fileEntry).size
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.lru.PushFront(entry)
+	}
+	c.bytes += entry.size
+	c.addTags(key, tags)
+	c.evict()
+	return nil
+}
+
+// mergeTags 合并标签并去重
+func mergeTags(old, tags []string) []string {
+	merged := append([]string{}, old...)
+	for _, tag := range tags {
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// evict 超出容量时从最久未访问处淘汰，至少保留最新写入的一项；调用方需持有锁
+func (c *FileCache) evict() {
+	for c.bytes > c.maxBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+		c.stats.evictions.Add(1)
+	}
+}
+
+// remove 删除文件与索引；调用方需持有锁
+func (c *FileCache) remove(elem *list.Element) {
+	entry := elem.Value.(*fileEntry)
+	if err := os.Remove(entry.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logx.WarnfM(context.Background(), "CacheMgr", "file cache remove %s: %v", entry.path, err)
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// addTags 记录键的标签，调用方需持有锁
+func (c *FileCache) addTags(key string, tags []string) {
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]struct{}{}
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+}
+
+// cleanup 定期删除过期文件
+func (c *FileCache) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.cleanSecs) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.dropExpired()
+		}
+	}
+}
+
+// dropExpired 删除过期项并清理失效的标签
+func (c *FileCache) dropExpired() {
+	c.Lock()
+	defer c.Unlock()
+	if c.checkOpen() != nil {
+		return
+	}
+	now := time.Now().UnixNano()
+	for _, elem := range c.entries {
+		if entry := elem.Value.(*fileEntry); entry.expiration > 0 && entry.expiration < now {
+			c.remove(elem)
+			c.stats.expirations.Add(1)
+		}
+	}
+	for tag, keys := range c.tags {
+		for key := range keys {
+			if _, ok := c.entries[key]; !ok {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+// Has 检查键是否存在
+func (c *FileCache) Has(ctx context.Context, key string) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.checkOpen() != nil {
+		return false
+	}
+	_, ok := c.load(key)
+	return ok
+}
+
+// Get 获取值
+func (c *FileCache) Get(ctx context.Context, key string) (jsonx.JValue, error) {
+	c.Lock()
+	if err := c.checkOpen(); err != nil {
+		c.Unlock()
+		return jsonx.JNull{}, err
+	}
+	data, _, ok := c.read(key)
+	c.Unlock()
+	c.stats.hit(ok)
+	if !ok {
+		return jsonx.JNull{}, cacheMiss(key)
+	}
+	return decodeValue(data), nil
+}
+
+// Set 设置值
+func (c *FileCache) Set(ctx context.Context, key string, value any, opts ...SetOpt) error {
+	return c.SetEx(ctx, key, value, 0, opts...)
+}
+
+// SetEx 设置带过期时间的值，expiration<=0表示不过期
+func (c *FileCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration, opts ...SetOpt) error {
+	data, err := c.codec.encode(value)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	if err := c.write(key, data, expireAt(expiration), applySetOpts(opts).tags); err != nil {
+		return err
+	}
+	c.stats.sets.Add(1)
+	return nil
+}
+
+// SetNX 键不存在时设置值
+func (c *FileCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	data, err := c.codec.encode(value)
+	if err != nil {
+		return false, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+	if _, ok := c.load(key); ok {
+		return false, nil
+	}
+	if err := c.write(key, data, expireAt(expiration), nil); err != nil {
+		return false, err
+	}
+	c.stats.sets.Add(1)
+	return true, nil
+}
+
+// Del 删除键
+func (c *FileCache) Del(ctx context.Context, keys ...string) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, key := range keys {
+		if _, ok := c.load(key); ok {
+			c.remove(c.entries[key])
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Expire 重设过期时间，需要重写文件
+func (c *FileCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+	data, entry, ok := c.read(key)
+	if !ok {
+		return false, nil
+	}
+	if err := c.write(key, data, expireAt(expiration), entry.tags); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TTL 剩余过期时间
+func (c *FileCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	entry, ok := c.load(key)
+	if !ok {
+		return 0, cacheMiss(key)
+	}
+	if entry.expiration == 0 {
+		return NoExpiration, nil
+	}
+	return time.Duration(entry.expiration - time.Now().UnixNano()), nil
+}
+
+// Incr 原子加1
+func (c *FileCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.IncrBy(ctx, key, 1)
+}
+
+// IncrBy 原子增加n，保留原过期时间
+func (c *FileCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	return c.incrBy(key, n)
+}
+
+// incrBy 见IncrBy，调用方需持有锁
+func (c *FileCache) incrBy(key string, n int64) (int64, error) {
+	data, entry, ok := c.read(key)
+	var val, expiration int64
+	var tags []string
+	if ok {
+		var err error
+		if val, err = strconv.ParseInt(string(data), 10, 64); err != nil {
+			return 0, fmt.Errorf("key %s value is not an integer", key)
+		}
+		expiration, tags = entry.expiration, entry.tags
+	}
+	val += n
+	if err := c.write(key, strconv.AppendInt(nil, val, 10), expiration, tags); err != nil {
+		return 0, err
+	}
+	return val, nil
+}
+
+// MGet 批量获取
+func (c *FileCache) MGet(ctx context.Context, keys ...string) (map[string]jsonx.JValue, error) {
+	datas := make(map[string][]byte, len(keys))
+	c.Lock()
+	if err := c.checkOpen(); err != nil {
+		c.Unlock()
+		return nil, err
+	}
+	for _, key := range keys {
+		if data, _, ok := c.read(key); ok {
+			datas[key] = data
+		}
+	}
+	c.Unlock()
+	c.stats.hits.Add(int64(len(datas)))
+	c.stats.misses.Add(int64(len(keys) - len(datas)))
+	vals := make(map[string]jsonx.JValue, len(datas))
+	for key, data := range datas {
+		vals[key] = decodeValue(data)
+	}
+	return vals, nil
+}
+
+// MSet 批量设置
+func (c *FileCache) MSet(ctx context.Context, values map[string]any, expiration time.Duration) error {
+	datas := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data, err := c.codec.encode(value)
+		if err != nil {
+			return fmt.Errorf("key %s: %v", key, err)
+		}
+		datas[key] = data
+	}
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+	for key, data := range datas {
+		if err := c.write(key, data, expireAt(expiration), nil); err != nil {
+			return err
+		}
+		c.stats.sets.Add(1)
+	}
+	return nil
+}
+
+// InvalidateTags 删除带有任一标签的键
+func (c *FileCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if _, ok := c.load(key); ok {
+				c.remove(c.entries[key])
+				n++
+			}
+		}
+		delete(c.tags, tag)
+	}
+	return n, nil
+}
+
+// Scan 遍历匹配pattern的未过期键
+func (c *FileCache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	// 先取快照再回调，fn内可以继续读写缓存
+	now := time.Now().UnixNano()
+	keys := make([]string, 0)
+	c.Lock()
+	if err := c.checkOpen(); err != nil {
+		c.Unlock()
+		return err
+	}
+	for key, elem := range c.entries {
+		entry := elem.Value.(*fileEntry)
+		if (entry.expiration == 0 || entry.expiration >= now) && globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	c.Unlock()
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return stopOrErr(err)
+		}
+	}
+	return nil
+}
+
+// Stats 统计快照
+func (c *FileCache) Stats() CacheStats {
+	stats := c.stats.snapshot()
+	c.Lock()
+	stats.Items, stats.Bytes = int64(len(c.entries)), c.bytes
+	c.Unlock()
+	return stats
+}
+
+// counters 统计计数
+func (c *FileCache) counters() *cacheCounters {
+	return &c.stats
+}
+
+// checkOpen Close后目录锁已释放，其他实例可能已接管该目录，不再读写；调用方需持有锁
+func (c *FileCache) checkOpen() error {
+	if c.lockFile == nil {
+		return fmt.Errorf("file cache %s: %w", c.dir, ErrCacheClosed)
+	}
+	return nil
+}
+
+// Close 停止清理协程并释放目录锁，磁盘上的数据保留；之后的读写返回ErrCacheClosed
+func (c *FileCache) Close(ctx context.Context) error {
+	c.cancel()
+	c.Lock()
+	defer c.Unlock()
+	if c.lockFile == nil {
+		return nil
+	}
+	err := c.lockFile.Close()
+	c.lockFile = nil
+	return err
+}
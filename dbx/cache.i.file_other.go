@@ -0,0 +1,18 @@
+//go:build !unix
+
+package dbx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockDir 非unix平台不加锁，只创建锁文件，同一目录仍只能由一个实例使用
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, fileLockName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("file cache lock %s: %w", dir, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockDir 以flock独占缓存目录，已被其他实例持有时返回错误；关闭文件即释放，进程退出时由内核释放
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, fileLockName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("file cache lock %s: %w", dir, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("file cache dir %s is used by another instance", dir)
+		}
+		return nil, fmt.Errorf("file cache lock %s: %w", dir, err)
+	}
+	return f, nil
+}
@@ -2,19 +2,27 @@ package dbx
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/fengzhi09/golibx/jsonx"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/logx"
 )
 
 // MemCache 内存缓存实现
 type MemCache struct {
 	lru       *gox.LRUMap[cacheItem]
 	cleanSecs int
+	tags      map[string]map[string]struct{} // 标签 -> 键
+	fences    map[string]int64               // 锁的fencing计数器，不随淘汰丢失
+	versions  map[string]int64               // 命名空间版本号，不随淘汰丢失
+	locks     map[string]cacheItem           // 锁，值为持有者，不随淘汰与定期清理丢失
+	stats     cacheCounters
+	codec     *valueCodec
+
 	sync.RWMutex
 }
 
@@ -28,7 +36,14 @@ type cacheItem struct {
 func NewMemCache(ctx context.Context, conf CacheConf) *MemCache {
 	size := conf.GetOr("max", 10000).ToInt()
 	cleanSec := conf.GetOr("clean_sec", 300).ToInt()
-	cache := &MemCache{lru: gox.NewLRUMap[cacheItem](size), cleanSecs: cleanSec}
+	codec, err := newValueCodec(conf)
+	if err != nil {
+		logx.WarnfM(ctx, "CacheMgr", "mem cache use json instead: %v", err)
+		codec = defaultCodec
+	}
+	cache := &MemCache{lru: gox.NewLRUMap[cacheItem](size), cleanSecs: cleanSec,
+		tags: map[string]map[string]struct{}{}, fences: map[string]int64{},
+		versions: map[string]int64{}, locks: map[string]cacheItem{}, codec: codec}
 	// 启动清理过期项的协程
 	go cache.cleanup(ctx)
 	return cache
@@ -36,63 +51,436 @@ func NewMemCache(ctx context.Context, conf CacheConf) *MemCache {
 
 // Has 检查键是否存在
 func (c *MemCache) Has(ctx context.Context, key string) bool {
-	return c.lru.Data().Has(key)
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.load(key)
+	return ok
 }
 
-// Get 获取值
-func (c *MemCache) Get(ctx context.Context, key string) (jsonx.JValue, error) {
+// load 读取未过期的项，过期项顺带删除；LRUMap非并发安全且Get会调整顺序，调用方需持有写锁
+func (c *MemCache) load(key string) (cacheItem, bool) {
 	item, exists := c.lru.Get(key)
-
 	if !exists {
-		return jsonx.JNull{}, fmt.Errorf("key %s not found", key)
+		return cacheItem{}, false
 	}
-
-	// 检查是否过期
-	if item.expiration > 0 && item.expiration < time.Now().UnixNano() {
-		// 删除过期项
+	if item.expired(time.Now().UnixNano()) {
 		c.lru.Del(key)
-		return jsonx.JNull{}, fmt.Errorf("key %s expired", key)
+		c.stats.expirations.Add(1)
+		return cacheItem{}, false
+	}
+	return item, true
+}
+
+// store 写入并统计超出容量被淘汰的项，调用方需持有写锁
+func (c *MemCache) store(key string, item cacheItem) {
+	expected := c.lru.Data().Len()
+	if !c.lru.Has(key) {
+		expected++
+	}
+	c.lru.Set(key, item)
+	c.stats.evictions.Add(int64(expected - c.lru.Data().Len()))
+}
+
+// expired 是否已过期
+func (item cacheItem) expired(now int64) bool {
+	return item.expiration > 0 && item.expiration < now
+}
+
+// expireAt 过期时间点，expiration<=0表示不过期
+func expireAt(expiration time.Duration) int64 {
+	if expiration <= 0 {
+		return 0
 	}
+	return time.Now().Add(expiration).UnixNano()
+}
 
-	return jsonx.GoV2JV(item.value), nil
+// Get 获取值
+func (c *MemCache) Get(ctx context.Context, key string) (jsonx.JValue, error) {
+	c.Lock()
+	item, ok := c.load(key)
+	c.Unlock()
+	c.stats.hit(ok)
+	if !ok {
+		return jsonx.JNull{}, cacheMiss(key)
+	}
+	return memValue(item), nil
+}
+
+// memValue 缓存项转为JValue
+func memValue(item cacheItem) jsonx.JValue {
+	return decodeValue(item.value)
 }
 
 // Set 设置值
-func (c *MemCache) Set(ctx context.Context, key string, value any) error {
-	data, err := json.Marshal(value)
+func (c *MemCache) Set(ctx context.Context, key string, value any, opts ...SetOpt) error {
+	data, err := c.codec.encode(value)
 	if err != nil {
 		return err
 	}
 
-	c.lru.Set(key, cacheItem{
+	c.Lock()
+	defer c.Unlock()
+	c.store(key, cacheItem{
 		value:      data,
 		expiration: 0, // 不过期, 但会被自动清除策略清除
 	})
+	c.stats.sets.Add(1)
+	c.addTags(key, applySetOpts(opts).tags)
 
 	return nil
 }
 
 // SetEx 设置带过期时间的值
-func (c *MemCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration) error {
-	data, err := json.Marshal(value)
+func (c *MemCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration, opts ...SetOpt) error {
+	data, err := c.codec.encode(value)
 	if err != nil {
 		return err
 	}
 
-	c.lru.Set(key, cacheItem{
+	c.Lock()
+	defer c.Unlock()
+	c.store(key, cacheItem{
 		value:      data,
-		expiration: time.Now().Add(expiration).UnixNano(),
+		expiration: expireAt(expiration),
 	})
+	c.stats.sets.Add(1)
+	c.addTags(key, applySetOpts(opts).tags)
+
+	return nil
+}
+
+// addTags 记录键的标签，调用方需持有写锁
+func (c *MemCache) addTags(key string, tags []string) {
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]struct{}{}
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+}
+
+// InvalidateTags 删除带有任一标签的键
+func (c *MemCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	var n int64
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if _, ok := c.load(key); ok {
+				c.lru.Del(key)
+				n++
+			}
+		}
+		delete(c.tags, tag)
+	}
+	return n, nil
+}
+
+// setRaw 写入已编码的值；valid在持有写锁时检查，返回false时放弃写入
+func (c *MemCache) setRaw(key string, data []byte, expiration time.Duration, valid func() bool) {
+	c.Lock()
+	defer c.Unlock()
+	if !valid() {
+		return
+	}
+	c.store(key, cacheItem{value: data, expiration: expireAt(expiration)})
+	c.stats.sets.Add(1)
+}
+
+// SetNX 键不存在时设置值
+func (c *MemCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	data, err := c.codec.encode(value)
+	if err != nil {
+		return false, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.load(key); ok {
+		return false, nil
+	}
+	c.store(key, cacheItem{value: data, expiration: expireAt(expiration)})
+	c.stats.sets.Add(1)
+	return true, nil
+}
+
+// Del 删除键
+func (c *MemCache) Del(ctx context.Context, keys ...string) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	var n int64
+	for _, key := range keys {
+		if _, ok := c.load(key); ok {
+			c.lru.Del(key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Expire 重设过期时间
+func (c *MemCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.load(key)
+	if !ok {
+		return false, nil
+	}
+	item.expiration = expireAt(expiration)
+	c.store(key, item)
+	return true, nil
+}
+
+// TTL 剩余过期时间
+func (c *MemCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.load(key)
+	if !ok {
+		return 0, cacheMiss(key)
+	}
+	if item.expiration == 0 {
+		return NoExpiration, nil
+	}
+	return time.Duration(item.expiration - time.Now().UnixNano()), nil
+}
 
+// Incr 原子加1
+func (c *MemCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.IncrBy(ctx, key, 1)
+}
+
+// IncrBy 原子增加n
+func (c *MemCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.load(key)
+	var val int64
+	if ok {
+		var err error
+		if val, err = strconv.ParseInt(string(item.value), 10, 64); err != nil {
+			return 0, fmt.Errorf("key %s value is not an integer", key)
+		}
+	}
+	val += n
+	item.value = strconv.AppendInt(nil, val, 10)
+	c.store(key, item)
+	return val, nil
+}
+
+// MGet 批量获取
+func (c *MemCache) MGet(ctx context.Context, keys ...string) (map[string]jsonx.JValue, error) {
+	items := make(map[string]cacheItem, len(keys))
+	c.Lock()
+	for _, key := range keys {
+		if item, ok := c.load(key); ok {
+			items[key] = item
+		}
+	}
+	c.Unlock()
+	c.stats.hits.Add(int64(len(items)))
+	c.stats.misses.Add(int64(len(keys) - len(items)))
+	vals := make(map[string]jsonx.JValue, len(items))
+	for key, item := range items {
+		vals[key] = memValue(item)
+	}
+	return vals, nil
+}
+
+// MSet 批量设置
+func (c *MemCache) MSet(ctx context.Context, values map[string]any, expiration time.Duration) error {
+	items := make(map[string]cacheItem, len(values))
+	for key, value := range values {
+		data, err := c.codec.encode(value)
+		if err != nil {
+			return fmt.Errorf("key %s: %v", key, err)
+		}
+		items[key] = cacheItem{value: data, expiration: expireAt(expiration)}
+	}
+	c.Lock()
+	defer c.Unlock()
+	for key, item := range items {
+		c.store(key, item)
+	}
+	c.stats.sets.Add(int64(len(items)))
 	return nil
 }
 
+// Scan 遍历匹配pattern的未过期键
+func (c *MemCache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	// 先取快照再回调，fn内可以继续读写缓存
+	now := time.Now().UnixNano()
+	keys := make([]string, 0)
+	c.Lock()
+	for key, item := range c.lru.Items() {
+		if !item.expired(now) && globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	c.Unlock()
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return stopOrErr(err)
+		}
+	}
+	return nil
+}
+
+// globMatch Redis风格的glob匹配：* 任意串，? 任意字符，[abc] [^a] [a-z] 字符集，\ 转义
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := 1
+			if end < len(pattern) && pattern[end] == '^' {
+				end++
+			}
+			// 首个]视为字面字符
+			if end < len(pattern) && pattern[end] == ']' {
+				end++
+			}
+			for end < len(pattern) && pattern[end] != ']' {
+				end++
+			}
+			if end >= len(pattern) {
+				// 未闭合的[按字面匹配
+				if s[0] != '[' {
+					return false
+				}
+				s = s[1:]
+				pattern = pattern[1:]
+				continue
+			}
+			if !classMatch(pattern[1:end], s[0]) {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[end+1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// classMatch 匹配[]内的字符集
+func classMatch(class string, ch byte) bool {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+	matched := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= ch && ch <= class[i+2] {
+				matched = true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == ch {
+			matched = true
+		}
+	}
+	return matched != negate
+}
+
 // Close 关闭缓存连接
 func (c *MemCache) Close(ctx context.Context) error {
+	c.Lock()
+	defer c.Unlock()
 	c.lru.Clear()
+	c.tags = map[string]map[string]struct{}{}
 	return nil
 }
 
+// dropExpired 删除已过期的项，调用方需持有写锁
+func (c *MemCache) dropExpired() {
+	now := time.Now().UnixNano()
+	expired := make([]string, 0)
+	for key, item := range c.lru.Items() {
+		if item.expired(now) {
+			expired = append(expired, key)
+		}
+	}
+	if len(expired) > 0 {
+		c.lru.Del(expired...)
+		c.stats.expirations.Add(int64(len(expired)))
+	}
+}
+
+// dropExpiredLocks 删除已过期的锁，调用方需持有写锁
+func (c *MemCache) dropExpiredLocks() {
+	now := time.Now().UnixNano()
+	for key, item := range c.locks {
+		if item.expired(now) {
+			delete(c.locks, key)
+		}
+	}
+}
+
+// Stats 统计快照，含当前条数与字节数
+func (c *MemCache) Stats() CacheStats {
+	stats := c.stats.snapshot()
+	c.Lock()
+	defer c.Unlock()
+	for key, item := range c.lru.Items() {
+		stats.Items++
+		stats.Bytes += int64(len(key) + len(item.value))
+	}
+	return stats
+}
+
+// counters 统计计数
+func (c *MemCache) counters() *cacheCounters {
+	return &c.stats
+}
+
+// pruneTags 移除标签中已不存在的键，调用方需持有写锁
+func (c *MemCache) pruneTags() {
+	for tag, keys := range c.tags {
+		for key := range keys {
+			if !c.lru.Has(key) {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
 // cleanup 清理过期项
 func (c *MemCache) cleanup(ctx context.Context) {
 	ticker := time.NewTicker(time.Duration(c.cleanSecs) * time.Second)
@@ -104,7 +492,14 @@ func (c *MemCache) cleanup(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			c.Lock()
+			c.dropExpired()
+			c.dropExpiredLocks()
+			before := c.lru.Data().Len()
 			c.lru.DropByUpdateAt(time.Now().UnixNano() - int64(c.cleanSecs)*1000000000)
+			c.stats.evictions.Add(int64(before - c.lru.Data().Len()))
+			c.pruneTags()
+			c.Unlock()
 		}
 	}
 
@@ -2,54 +2,177 @@ package dbx
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/fengzhi09/golibx/jsonx"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-// RedisCache Redis缓存实现
+// RedisCache Redis缓存实现，支持单节点、哨兵与集群模式
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
+	stats  cacheCounters
+	codec  *valueCodec
 }
 
-// NewRedisCache 创建Redis缓存实例
+// NewRedisCache 创建Redis缓存实例；mode为single(默认)、sentinel或cluster，见redisOptions
 func NewRedisCache(ctx context.Context, conf CacheConf) (*RedisCache, error) {
 	// 解析配置
-	addr, ok := conf["addr"].(string)
-	if !ok {
-		return nil, fmt.Errorf("redis addr not found in config")
+	mode := getOrDefault(&conf, "mode", "single")
+	opts, err := redisOptions(conf, mode)
+	if err != nil {
+		return nil, err
 	}
-
-	db := 0
-	if dbVal, exists := conf["db"]; exists {
-		db = int(dbVal.(float64))
+	codec, err := newValueCodec(conf)
+	if err != nil {
+		return nil, err
 	}
 
-	password := ""
-	if pwVal, exists := conf["password"]; exists {
-		password = pwVal.(string)
+	var client redis.UniversalClient
+	switch mode {
+	case "single":
+		client = redis.NewClient(opts.Simple())
+	case "sentinel":
+		client = redis.NewFailoverClient(opts.Failover())
+	case "cluster":
+		client = redis.NewClusterClient(opts.Cluster())
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-	})
-
 	// 测试连接
-	_, err := client.Ping(ctx).Result()
+	_, err = client.Ping(ctx).Result()
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to redis: %v", err)
 	}
 
 	return &RedisCache{
 		client: client,
+		codec:  codec,
 	}, nil
 }
 
+// redisOptions 解析连接配置：
+// addr/addrs 地址(addrs为数组或逗号分隔)，master_name 哨兵主节点名，db(集群不支持)，username，password，sentinel_password，
+// pool_size，min_idle_conns，dial_timeout_ms，read_timeout_ms，write_timeout_ms，pool_timeout_ms，
+// tls 是否启用TLS，tls_server_name，tls_skip_verify，tls_ca_file，tls_cert_file/tls_key_file 客户端证书
+func redisOptions(conf CacheConf, mode string) (*redis.UniversalOptions, error) {
+	addrs := make([]string, 0)
+	if conf.Contains("addrs") {
+		if arr, ok := conf["addrs"].([]any); ok {
+			for _, addr := range arr {
+				addrs = append(addrs, fmt.Sprint(addr))
+			}
+		} else if arr, ok := conf["addrs"].([]string); ok {
+			addrs = append(addrs, arr...)
+		} else {
+			for _, addr := range strings.Split(conf.GetStr("addrs"), ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+	}
+	if addr := getOrDefault(&conf, "addr", ""); addr != "" {
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("redis addr not found in config")
+	}
+
+	ms := func(key string) time.Duration {
+		return time.Duration(getIntOr(&conf, key, 0)) * time.Millisecond
+	}
+	opts := &redis.UniversalOptions{
+		Addrs:            addrs,
+		DB:               getIntOr(&conf, "db", 0),
+		Username:         getOrDefault(&conf, "username", ""),
+		Password:         getOrDefault(&conf, "password", ""),
+		SentinelPassword: getOrDefault(&conf, "sentinel_password", ""),
+		MasterName:       getOrDefault(&conf, "master_name", ""),
+		PoolSize:         getIntOr(&conf, "pool_size", 0),
+		MinIdleConns:     getIntOr(&conf, "min_idle_conns", 0),
+		DialTimeout:      ms("dial_timeout_ms"),
+		ReadTimeout:      ms("read_timeout_ms"),
+		WriteTimeout:     ms("write_timeout_ms"),
+		PoolTimeout:      ms("pool_timeout_ms"),
+	}
+
+	switch mode {
+	case "single":
+		if len(addrs) > 1 {
+			return nil, fmt.Errorf("redis single mode accepts one addr, got %v", addrs)
+		}
+	case "sentinel":
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode requires master_name")
+		}
+	case "cluster":
+		if opts.DB != 0 {
+			return nil, fmt.Errorf("redis cluster mode does not support db %d", opts.DB)
+		}
+	default:
+		return nil, fmt.Errorf("redis mode %q not supported", mode)
+	}
+
+	if conf.GetBool("tls") {
+		cfg, err := redisTLS(conf)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = cfg
+	}
+	return opts, nil
+}
+
+// redisTLS TLS配置
+func redisTLS(conf CacheConf) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         getOrDefault(&conf, "tls_server_name", ""),
+		InsecureSkipVerify: conf.GetBool("tls_skip_verify"),
+	}
+	if caFile := getOrDefault(&conf, "tls_ca_file", ""); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_ca_file: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in tls_ca_file %s", caFile)
+		}
+	}
+	if certFile := getOrDefault(&conf, "tls_cert_file", ""); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, getOrDefault(&conf, "tls_key_file", ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client cert: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Stats 统计快照；Redis不统计淘汰、过期与条数
+func (r *RedisCache) Stats() CacheStats {
+	return r.stats.snapshot()
+}
+
+// counters 统计计数
+func (r *RedisCache) counters() *cacheCounters {
+	return &r.stats
+}
+
+// isCluster 集群模式下跨slot的多键命令需要按键拆分
+func (r *RedisCache) isCluster() bool {
+	_, ok := r.client.(*redis.ClusterClient)
+	return ok
+}
+
 // Has 检查键是否存在
 func (r *RedisCache) Has(ctx context.Context, key string) bool {
 	exists, err := r.client.Exists(ctx, key).Result()
@@ -58,28 +181,367 @@ func (r *RedisCache) Has(ctx context.Context, key string) bool {
 
 // Get 获取值
 func (r *RedisCache) Get(ctx context.Context, key string) (jsonx.JValue, error) {
-	val := r.client.Get(ctx, key).Val()
-	return jsonx.GoV2JV(val), nil
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		r.stats.misses.Add(1)
+		return jsonx.JNull{}, cacheMiss(key)
+	}
+	if err != nil {
+		return jsonx.JNull{}, fmt.Errorf("redis get %s: %w", key, err)
+	}
+	r.stats.hits.Add(1)
+	return decodeValue(data), nil
+}
+
+// getRaw 在同一个管道中读取原始值与剩余过期时间，不过期时为NoExpiration
+func (r *RedisCache) getRaw(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, 0, cacheMiss(key)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis get %s: %w", key, err)
+	}
+	data, _ := get.Bytes()
+	return data, max(pttl.Val(), NoExpiration), nil
 }
 
 // Set 设置值
-func (r *RedisCache) Set(ctx context.Context, key string, value any) error {
-	data, err := json.Marshal(value)
+func (r *RedisCache) Set(ctx context.Context, key string, value any, opts ...SetOpt) error {
+	data, err := r.codec.encode(value)
 	if err != nil {
 		return err
 	}
 
-	return r.client.Set(ctx, key, data, 0).Err()
+	return r.set(ctx, key, data, 0, applySetOpts(opts).tags)
 }
 
 // SetEx 设置带过期时间的值
-func (r *RedisCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration) error {
-	data, err := json.Marshal(value)
+func (r *RedisCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration, opts ...SetOpt) error {
+	data, err := r.codec.encode(value)
 	if err != nil {
 		return err
 	}
 
-	return r.client.Set(ctx, key, data, expiration).Err()
+	return r.set(ctx, key, data, expiration, applySetOpts(opts).tags)
+}
+
+// set 写入值；有标签时在同一事务中把键加入各标签集合
+func (r *RedisCache) set(ctx context.Context, key string, data []byte, expiration time.Duration, tags []string) error {
+	r.stats.sets.Add(1)
+	// go-redis把-1当作KEEPTTL，统一为不过期
+	expiration = max(expiration, 0)
+	if len(tags) == 0 {
+		return r.client.Set(ctx, key, data, expiration).Err()
+	}
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, expiration)
+		for _, tag := range tags {
+			tagScript.Eval(ctx, pipe, []string{tagKeyPrefix + tag}, key, expiration.Milliseconds())
+		}
+		return nil
+	})
+	return err
+}
+
+// tagKeyPrefix 标签集合的键前缀
+const tagKeyPrefix = "dbx:tag:"
+
+// tagScript 把键加入标签集合，集合的过期时间不短于其中的键；不过期的键使集合也不过期
+var tagScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local exp = tonumber(ARGV[2])
+local ttl = redis.call('PTTL', KEYS[1])
+if exp <= 0 then
+	redis.call('PERSIST', KEYS[1])
+elseif existed == 0 or (ttl >= 0 and ttl < exp) then
+	redis.call('PEXPIRE', KEYS[1], exp)
+end
+return 1
+`)
+
+// invalidateScript 删除标签集合中的键及集合本身，返回{删除个数, 键...}
+var invalidateScript = redis.NewScript(`
+local n = 0
+local keys = {}
+for _, tag in ipairs(KEYS) do
+	for _, key in ipairs(redis.call('SMEMBERS', tag)) do
+		n = n + redis.call('DEL', key)
+		table.insert(keys, key)
+	end
+	redis.call('DEL', tag)
+end
+table.insert(keys, 1, n)
+return keys
+`)
+
+// InvalidateTags 删除带有任一标签的键
+func (r *RedisCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	n, _, err := r.invalidateTags(ctx, tags...)
+	return n, err
+}
+
+// invalidateTags 在脚本中原子地删除标签下的键，返回删除个数与标签下的全部键
+func (r *RedisCache) invalidateTags(ctx context.Context, tags ...string) (int64, []string, error) {
+	if len(tags) == 0 {
+		return 0, nil, nil
+	}
+	tagKeys := make([]string, len(tags))
+	for i, tag := range tags {
+		tagKeys[i] = tagKeyPrefix + tag
+	}
+	if r.isCluster() {
+		return r.invalidateTagsCluster(ctx, tagKeys)
+	}
+	res, err := invalidateScript.Run(ctx, r.client, tagKeys).Slice()
+	if err != nil {
+		return 0, nil, fmt.Errorf("redis invalidate tags %v: %w", tags, err)
+	}
+	keys := make([]string, 0, len(res)-1)
+	for _, key := range res[1:] {
+		keys = append(keys, fmt.Sprint(key))
+	}
+	return res[0].(int64), keys, nil
+}
+
+// invalidateTagsCluster 集群中标签与键分布在不同slot，无法在脚本中执行，逐个标签读取后删除(非原子)
+func (r *RedisCache) invalidateTagsCluster(ctx context.Context, tagKeys []string) (int64, []string, error) {
+	var n int64
+	keys := make([]string, 0)
+	for _, tagKey := range tagKeys {
+		members, err := r.client.SMembers(ctx, tagKey).Result()
+		if err != nil {
+			return n, keys, fmt.Errorf("redis invalidate tag %v: %w", tagKey, err)
+		}
+		deleted, err := r.Del(ctx, members...)
+		if err != nil {
+			return n, keys, err
+		}
+		n += deleted
+		keys = append(keys, members...)
+		if err := r.client.Del(ctx, tagKey).Err(); err != nil {
+			return n, keys, err
+		}
+	}
+	return n, keys, nil
+}
+
+// SetNX 键不存在时设置值
+func (r *RedisCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	data, err := r.codec.encode(value)
+	if err != nil {
+		return false, err
+	}
+	ok, err := r.client.SetNX(ctx, key, data, max(expiration, 0)).Result()
+	if ok {
+		r.stats.sets.Add(1)
+	}
+	return ok, err
+}
+
+// Del 删除键
+func (r *RedisCache) Del(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if !r.isCluster() {
+		return r.client.Del(ctx, keys...).Result()
+	}
+	cmds, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.(*redis.IntCmd).Val()
+	}
+	return n, nil
+}
+
+// Expire 重设过期时间，expiration<=0时PERSIST
+func (r *RedisCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	if expiration <= 0 {
+		// PERSIST对无过期时间的键也返回false，需要区分键是否存在
+		if _, err := r.client.Persist(ctx, key).Result(); err != nil {
+			return false, err
+		}
+		return r.Has(ctx, key), nil
+	}
+	return r.client.Expire(ctx, key, expiration).Result()
+}
+
+// TTL 剩余过期时间
+func (r *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// -2 键不存在，-1 不过期
+	switch ttl {
+	case -2:
+		return 0, cacheMiss(key)
+	case -1:
+		return NoExpiration, nil
+	}
+	return ttl, nil
+}
+
+// Incr 原子加1
+func (r *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return r.IncrBy(ctx, key, 1)
+}
+
+// IncrBy 原子增加n
+func (r *RedisCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return r.client.IncrBy(ctx, key, n).Result()
+}
+
+// MGet 批量获取
+func (r *RedisCache) MGet(ctx context.Context, keys ...string) (map[string]jsonx.JValue, error) {
+	vals, err := r.mget(ctx, keys)
+	if err == nil {
+		r.stats.hits.Add(int64(len(vals)))
+		r.stats.misses.Add(int64(len(keys) - len(vals)))
+	}
+	return vals, err
+}
+
+// mget 单节点使用MGET，集群按键拆分
+func (r *RedisCache) mget(ctx context.Context, keys []string) (map[string]jsonx.JValue, error) {
+	vals := make(map[string]jsonx.JValue, len(keys))
+	if len(keys) == 0 {
+		return vals, nil
+	}
+	if r.isCluster() {
+		// 集群中MGET要求键在同一slot，改为管道逐个GET
+		cmds, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Get(ctx, key)
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			if data, err := cmd.(*redis.StringCmd).Bytes(); err == nil {
+				vals[keys[i]] = decodeValue(data)
+			}
+		}
+		return vals, nil
+	}
+	res, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, val := range res {
+		if str, ok := val.(string); ok {
+			vals[keys[i]] = decodeValue([]byte(str))
+		}
+	}
+	return vals, nil
+}
+
+// rawEntry 原始值与剩余过期时间
+type rawEntry struct {
+	data []byte
+	ttl  time.Duration
+}
+
+// mgetRaw 在一个管道中逐个GET与PTTL，返回存在的键的原始值与剩余过期时间
+func (r *RedisCache) mgetRaw(ctx context.Context, keys []string) (map[string]rawEntry, error) {
+	entries := make(map[string]rawEntry, len(keys))
+	if len(keys) == 0 {
+		return entries, nil
+	}
+	gets := make([]*redis.StringCmd, len(keys))
+	pttls := make([]*redis.DurationCmd, len(keys))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(ctx, key)
+			pttls[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, get := range gets {
+		if data, err := get.Bytes(); err == nil {
+			entries[keys[i]] = rawEntry{data: data, ttl: max(pttls[i].Val(), NoExpiration)}
+		}
+	}
+	return entries, nil
+}
+
+// MSet 批量设置，在MULTI/EXEC事务中执行
+func (r *RedisCache) MSet(ctx context.Context, values map[string]any, expiration time.Duration) error {
+	datas := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data, err := r.codec.encode(value)
+		if err != nil {
+			return fmt.Errorf("key %s: %v", key, err)
+		}
+		datas[key] = data
+	}
+	if len(datas) == 0 {
+		return nil
+	}
+	r.stats.sets.Add(int64(len(datas)))
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, data := range datas {
+			pipe.Set(ctx, key, data, max(expiration, 0))
+		}
+		return nil
+	})
+	return err
+}
+
+// Scan 以SCAN遍历匹配pattern的键，集群模式下遍历所有主节点；遍历期间有写入时同一个键可能返回多次
+func (r *RedisCache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return stopOrErr(scanNode(ctx, r.client, pattern, fn))
+	}
+	// ForEachMaster并发执行，回调需串行
+	var mutex sync.Mutex
+	var stopped bool
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scanNode(ctx, node, pattern, func(key string) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if stopped {
+				return ErrStopEach
+			}
+			err := fn(key)
+			stopped = err != nil
+			return err
+		})
+	})
+	return stopOrErr(err)
+}
+
+// scanNode 遍历单个节点
+func scanNode(ctx context.Context, client redis.Cmdable, pattern string, fn func(key string) error) error {
+	iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(iter.Val()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
 }
 
 // Close 关闭缓存连接
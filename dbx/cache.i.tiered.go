@@ -0,0 +1,301 @@
+package dbx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync/atomic"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TieredCache 两级缓存：先查进程内MemCache，未命中再查Redis并回填本地；
+// 写入与删除通过Redis pub/sub通知其他实例淘汰本地副本，消息丢失时本地副本最多保留local_ttl_sec；
+// 读Redis期间发生的写入或失效会使本次回填作废，不会以旧值覆盖
+type TieredCache struct {
+	local     *MemCache
+	remote    *RedisCache
+	localTTL  time.Duration
+	remoteTTL time.Duration
+	channel   string
+	id        string // 实例ID，忽略自己发出的失效消息
+	pubsub    *redis.PubSub
+	cancel    context.CancelFunc
+	done      chan struct{}
+	stats     cacheCounters // 命中(任一层)、未命中与回源
+	// gens 按键哈希分桶的失效代数；回填前比对，避免读Redis期间发生的写入或失效被旧值覆盖
+	gens [256]atomic.Uint64
+}
+
+// invalidateMsg 失效消息
+type invalidateMsg struct {
+	Src  string   `json:"src"`
+	Keys []string `json:"keys"`
+}
+
+// NewTieredCache 创建两级缓存；conf同Redis配置，另支持:
+// local_max 本地最大条数(默认10000)，local_ttl_sec 本地过期秒数(默认60)，
+// remote_ttl_sec Set/MSet等未指定过期时间时Redis的过期秒数(默认0不过期)，invalidate_channel 失效频道
+func NewTieredCache(ctx context.Context, conf CacheConf) (*TieredCache, error) {
+	remote, err := NewRedisCache(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &TieredCache{
+		local:     NewMemCache(ctx, CacheConf{"max": getIntOr(&conf, "local_max", 10000)}),
+		remote:    remote,
+		localTTL:  time.Duration(getIntOr(&conf, "local_ttl_sec", 60)) * time.Second,
+		remoteTTL: time.Duration(getIntOr(&conf, "remote_ttl_sec", 0)) * time.Second,
+		channel:   getOrDefault(&conf, "invalidate_channel", "dbx:cache:invalidate"),
+		id:        NewOID().Hex(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	// 本地层直接存放Redis中的原始字节，编码保持一致
+	c.local.codec = remote.codec
+	c.pubsub = remote.client.Subscribe(ctx, c.channel)
+	// 等待订阅确认，保证创建后的写入都能收到
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		cancel()
+		c.pubsub.Close()
+		remote.Close(ctx)
+		return nil, fmt.Errorf("failed to subscribe %s: %v", c.channel, err)
+	}
+	go c.listen(ctx)
+	return c, nil
+}
+
+// listen 接收其他实例的失效消息并淘汰本地副本
+func (c *TieredCache) listen(ctx context.Context) {
+	defer close(c.done)
+	for msg := range c.pubsub.Channel() {
+		var inv invalidateMsg
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			logx.WarnfM(ctx, "CacheMgr", "bad invalidate message: %v", err)
+			continue
+		}
+		if inv.Src != c.id {
+			c.evictLocal(ctx, inv.Keys...)
+		}
+	}
+}
+
+// invalidate 淘汰本地副本并通知其他实例；通知失败只记录日志
+func (c *TieredCache) invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	c.evictLocal(ctx, keys...)
+	data, _ := json.Marshal(invalidateMsg{Src: c.id, Keys: keys})
+	if err := c.remote.client.Publish(ctx, c.channel, data).Err(); err != nil {
+		logx.WarnfM(ctx, "CacheMgr", "publish invalidate %v failed: %v", keys, err)
+	}
+}
+
+// gen 键所在分桶的失效代数
+func (c *TieredCache) gen(key string) *atomic.Uint64 {
+	return &c.gens[crc32.ChecksumIEEE([]byte(key))%uint32(len(c.gens))]
+}
+
+// evictLocal 先递增失效代数再淘汰本地副本
+func (c *TieredCache) evictLocal(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		c.gen(key).Add(1)
+	}
+	c.local.Del(ctx, keys...)
+}
+
+// backfill 回填本地；gen为读Redis之前的失效代数，其间发生过失效时放弃。
+// 比对与写入都在本地层的锁内，淘汰要么使比对失败，要么在回填之后删除
+func (c *TieredCache) backfill(key string, gen uint64, data []byte, ttl time.Duration) {
+	c.local.setRaw(key, data, c.localExp(ttl), func() bool { return c.gen(key).Load() == gen })
+}
+
+// remoteExp Redis过期时间，未指定时使用remote_ttl_sec
+func (c *TieredCache) remoteExp(expiration time.Duration) time.Duration {
+	if expiration > 0 {
+		return expiration
+	}
+	return c.remoteTTL
+}
+
+// localExp 本地过期时间，不超过Redis剩余时间
+func (c *TieredCache) localExp(remote time.Duration) time.Duration {
+	if remote > 0 && remote < c.localTTL {
+		return remote
+	}
+	return c.localTTL
+}
+
+// Has 检查键是否存在
+func (c *TieredCache) Has(ctx context.Context, key string) bool {
+	return c.local.Has(ctx, key) || c.remote.Has(ctx, key)
+}
+
+// Get 先查本地，未命中时查Redis并回填本地
+func (c *TieredCache) Get(ctx context.Context, key string) (jsonx.JValue, error) {
+	if val, err := c.local.Get(ctx, key); err == nil {
+		c.stats.hits.Add(1)
+		return val, nil
+	}
+	gen := c.gen(key).Load()
+	data, ttl, err := c.remote.getRaw(ctx, key)
+	if errors.Is(err, ErrCacheMiss) {
+		c.stats.misses.Add(1)
+	}
+	if err != nil {
+		return jsonx.JNull{}, err
+	}
+	c.stats.hits.Add(1)
+	c.backfill(key, gen, data, ttl)
+	return decodeValue(data), nil
+}
+
+// Set 设置值
+func (c *TieredCache) Set(ctx context.Context, key string, value any, opts ...SetOpt) error {
+	return c.SetEx(ctx, key, value, 0, opts...)
+}
+
+// SetEx 设置带过期时间的值
+func (c *TieredCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration, opts ...SetOpt) error {
+	if err := c.remote.SetEx(ctx, key, value, c.remoteExp(expiration), opts...); err != nil {
+		return err
+	}
+	c.invalidate(ctx, key)
+	return nil
+}
+
+// SetNX 键不存在时设置值
+func (c *TieredCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	ok, err := c.remote.SetNX(ctx, key, value, c.remoteExp(expiration))
+	if ok {
+		c.invalidate(ctx, key)
+	}
+	return ok, err
+}
+
+// Del 删除键
+func (c *TieredCache) Del(ctx context.Context, keys ...string) (int64, error) {
+	n, err := c.remote.Del(ctx, keys...)
+	if err != nil {
+		return n, err
+	}
+	c.invalidate(ctx, keys...)
+	return n, nil
+}
+
+// Expire 重设过期时间
+func (c *TieredCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	ok, err := c.remote.Expire(ctx, key, expiration)
+	if ok {
+		c.invalidate(ctx, key)
+	}
+	return ok, err
+}
+
+// InvalidateTags 删除Redis中带有任一标签的键，并淘汰各实例的本地副本
+func (c *TieredCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	n, keys, err := c.remote.invalidateTags(ctx, tags...)
+	if err != nil {
+		return n, err
+	}
+	c.invalidate(ctx, keys...)
+	return n, nil
+}
+
+// TTL 剩余过期时间，以Redis为准
+func (c *TieredCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.remote.TTL(ctx, key)
+}
+
+// Incr 原子加1
+func (c *TieredCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.IncrBy(ctx, key, 1)
+}
+
+// IncrBy 原子增加n
+func (c *TieredCache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	val, err := c.remote.IncrBy(ctx, key, n)
+	if err != nil {
+		return val, err
+	}
+	c.invalidate(ctx, key)
+	return val, nil
+}
+
+// MGet 批量获取，本地未命中的键从Redis读取并回填
+func (c *TieredCache) MGet(ctx context.Context, keys ...string) (map[string]jsonx.JValue, error) {
+	vals, _ := c.local.MGet(ctx, keys...)
+	missing := make([]string, 0, len(keys)-len(vals))
+	for _, key := range keys {
+		if _, ok := vals[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		gens := make(map[string]uint64, len(missing))
+		for _, key := range missing {
+			gens[key] = c.gen(key).Load()
+		}
+		remote, err := c.remote.mgetRaw(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for key, entry := range remote {
+			vals[key] = decodeValue(entry.data)
+			c.backfill(key, gens[key], entry.data, entry.ttl)
+		}
+	}
+	c.stats.hits.Add(int64(len(vals)))
+	c.stats.misses.Add(int64(len(keys) - len(vals)))
+	return vals, nil
+}
+
+// MSet 批量设置
+func (c *TieredCache) MSet(ctx context.Context, values map[string]any, expiration time.Duration) error {
+	if err := c.remote.MSet(ctx, values, c.remoteExp(expiration)); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	c.invalidate(ctx, keys...)
+	return nil
+}
+
+// Scan 遍历Redis中匹配pattern的键
+func (c *TieredCache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	return c.remote.Scan(ctx, pattern, fn)
+}
+
+// Stats 统计快照：写入次数来自Redis层，淘汰、过期、条数与字节数来自本地层
+func (c *TieredCache) Stats() CacheStats {
+	stats := c.stats.snapshot()
+	local := c.local.Stats()
+	stats.Sets = c.remote.stats.sets.Load()
+	stats.Evictions, stats.Expirations = local.Evictions, local.Expirations
+	stats.Items, stats.Bytes = local.Items, local.Bytes
+	return stats
+}
+
+// counters 统计计数
+func (c *TieredCache) counters() *cacheCounters {
+	return &c.stats
+}
+
+// Close 停止订阅并关闭两级缓存
+func (c *TieredCache) Close(ctx context.Context) error {
+	c.cancel()
+	c.pubsub.Close()
+	<-c.done
+	c.local.Close(ctx)
+	return c.remote.Close(ctx)
+}
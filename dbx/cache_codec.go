@@ -0,0 +1,365 @@
+package dbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/ugorji/go/codec"
+)
+
+// Codec 缓存值编解码器；解码结果统一为JValue
+type Codec interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte) (jsonx.JValue, error)
+}
+
+// 头字节：高4位固定为0x1，与无头的旧JSON数据(首字节为可见字符或空白)区分；
+// 0x08表示gzip压缩，低3位为编解码器编号
+const (
+	hdrMagic     byte = 0x10
+	hdrMagicMask byte = 0xF0
+	hdrGzip      byte = 0x08
+	hdrCodecMask byte = 0x07
+)
+
+// 内置编解码器编号，5~7留给RegisterCodec
+const (
+	codecJSON byte = iota + 1
+	codecMsgpack
+	codecGob
+	codecRaw
+)
+
+var (
+	codecMutex sync.RWMutex
+	codecIDs   = map[string]byte{"json": codecJSON, "msgpack": codecMsgpack, "gob": codecGob, "raw": codecRaw}
+	codecs     = map[byte]Codec{codecJSON: jsonCodec{}, codecMsgpack: msgpackCodec{}, codecGob: gobCodec{}, codecRaw: rawCodec{}}
+)
+
+// RegisterCodec 注册自定义编解码器，id取5~7，写入头字节以便读取端识别
+func RegisterCodec(name string, id byte, c Codec) error {
+	if id <= codecRaw || id > hdrCodecMask {
+		return fmt.Errorf("codec %s: id %d out of range 5~7", name, id)
+	}
+	codecMutex.Lock()
+	defer codecMutex.Unlock()
+	if _, ok := codecs[id]; ok {
+		return fmt.Errorf("codec %s: id %d already registered", name, id)
+	}
+	codecIDs[name], codecs[id] = id, c
+	return nil
+}
+
+// codecByID 按编号查找编解码器
+func codecByID(id byte) (Codec, bool) {
+	codecMutex.RLock()
+	defer codecMutex.RUnlock()
+	c, ok := codecs[id]
+	return c, ok
+}
+
+// valueCodec 单个缓存的编码配置；未配置codec与compress时写无头的JSON，与旧数据一致
+type valueCodec struct {
+	codec       Codec
+	id          byte
+	header      bool
+	compress    bool
+	compressMin int
+}
+
+// defaultCodec 无头JSON
+var defaultCodec = &valueCodec{codec: jsonCodec{}, id: codecJSON}
+
+// newValueCodec 解析codec、compress、compress_min配置
+func newValueCodec(conf CacheConf) (*valueCodec, error) {
+	compress := conf.GetBool("compress")
+	if !conf.Contains("codec") && !compress {
+		return defaultCodec, nil
+	}
+	name := getOrDefault(&conf, "codec", "json")
+	codecMutex.RLock()
+	id, ok := codecIDs[name]
+	c := codecs[id]
+	codecMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("codec %s not supported", name)
+	}
+	return &valueCodec{codec: c, id: id, header: true, compress: compress,
+		compressMin: getIntOr(&conf, "compress_min", 1024)}, nil
+}
+
+// encode 编码值；整数始终写为十进制文本，保证Incr与Redis INCR可用
+func (vc *valueCodec) encode(value any) ([]byte, error) {
+	if n, ok := intValue(value); ok {
+		return strconv.AppendInt(nil, n, 10), nil
+	}
+	data, err := vc.codec.Marshal(value)
+	if err != nil || !vc.header {
+		return data, err
+	}
+	hdr := hdrMagic | vc.id
+	if vc.compress && len(data) >= vc.compressMin {
+		if data, err = gzipBytes(data); err != nil {
+			return nil, err
+		}
+		hdr |= hdrGzip
+	}
+	return append([]byte{hdr}, data...), nil
+}
+
+// decodeValue 按头字节解码，无头数据按JSON解码，整数(含嵌套)还原为JInt；
+// 非JSON或解码失败的数据(如其他客户端写入)按字符串返回
+func decodeValue(data []byte) jsonx.JValue {
+	if len(data) > 0 && data[0]&hdrMagicMask == hdrMagic {
+		if val, err := decodeHeader(data); err == nil {
+			return val
+		}
+		return jsonx.NewJStr(string(data))
+	}
+	val, err := jsonCodec{}.Unmarshal(data)
+	if err != nil {
+		return jsonx.NewJStr(string(data))
+	}
+	return val
+}
+
+// decodeHeader 解码带头字节的数据
+func decodeHeader(data []byte) (jsonx.JValue, error) {
+	hdr, payload := data[0], data[1:]
+	c, ok := codecByID(hdr & hdrCodecMask)
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %d", hdr&hdrCodecMask)
+	}
+	if hdr&hdrGzip != 0 {
+		var err error
+		if payload, err = gunzipBytes(payload); err != nil {
+			return nil, err
+		}
+	}
+	return c.Unmarshal(payload)
+}
+
+// intValue 整数类型的值
+func intValue(value any) (int64, bool) {
+	switch v := value.(type) {
+	case jsonx.JInt:
+		return int64(v), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		return reflect.ValueOf(v).Convert(reflect.TypeOf(int64(0))).Int(), true
+	}
+	return 0, false
+}
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// gzipBytes gzip压缩
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipBytes gzip解压
+func gunzipBytes(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gunzip: %w", err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// numberValue 递归转换解码结果；GoV2JV会把嵌套的json.Number当作字符串
+func numberValue(val any) jsonx.JValue {
+	switch v := val.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return jsonx.NewJInt(n)
+		}
+		f, _ := v.Float64()
+		return jsonx.NewJNum(f)
+	case map[string]any:
+		obj := jsonx.JObj{}
+		for key, item := range v {
+			obj.PutVal(key, numberValue(item))
+		}
+		return &obj
+	case []any:
+		arr := jsonx.JArr{}
+		for _, item := range v {
+			arr.AddVal(numberValue(item))
+		}
+		return &arr
+	}
+	return jsonx.GoV2JV(val)
+}
+
+// plainValue 将jsonx值递归转为map[string]any、[]any与基本类型，供非JSON编解码器使用
+func plainValue(value any) any {
+	switch v := value.(type) {
+	case nil, jsonx.JNull:
+		return nil
+	case *jsonx.JObj:
+		if v == nil {
+			return nil
+		}
+		return plainMap(*v)
+	case jsonx.JObj:
+		return plainMap(v)
+	case map[string]any:
+		return plainMap(v)
+	case *jsonx.JArr:
+		if v == nil {
+			return nil
+		}
+		return plainSlice(*v)
+	case jsonx.JArr:
+		return plainSlice(v)
+	case []any:
+		return plainSlice(v)
+	case jsonx.JValue:
+		return v.ToGVal()
+	}
+	return value
+}
+
+// plainMap 见plainValue
+func plainMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for key, item := range m {
+		out[key] = plainValue(item)
+	}
+	return out
+}
+
+// plainSlice 见plainValue
+func plainSlice(s []any) []any {
+	out := make([]any, len(s))
+	for i, item := range s {
+		out[i] = plainValue(item)
+	}
+	return out
+}
+
+// jsonAPI 与encoding/json输出一致，解码保留数字精度
+var jsonAPI = sonic.Config{EscapeHTML: true, SortMapKeys: true, UseNumber: true}.Froze()
+
+// jsonCodec 基于sonic的JSON
+type jsonCodec struct{}
+
+// Marshal 编码
+func (jsonCodec) Marshal(value any) ([]byte, error) {
+	return jsonAPI.Marshal(value)
+}
+
+// Unmarshal 解码，须为单个完整的JSON值
+func (jsonCodec) Unmarshal(data []byte) (jsonx.JValue, error) {
+	var val any
+	if err := jsonAPI.Unmarshal(data, &val); err != nil {
+		return nil, err
+	}
+	return numberValue(val), nil
+}
+
+// msgpackHandle 字符串按str类型读写，map解码为map[string]any
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	return h
+}()
+
+// msgpackCodec MessagePack，结构体沿用codec或json标签
+type msgpackCodec struct{}
+
+// Marshal 编码
+func (msgpackCodec) Marshal(value any) ([]byte, error) {
+	var data []byte
+	if err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(plainValue(value)); err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal 解码
+func (msgpackCodec) Unmarshal(data []byte) (jsonx.JValue, error) {
+	var val any
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&val); err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	return numberValue(val), nil
+}
+
+func init() {
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register(time.Time{})
+}
+
+// gobBox gob不能直接编码顶层的接口值
+type gobBox struct {
+	V any
+}
+
+// gobCodec encoding/gob，自定义结构体需先gob.Register
+type gobCodec struct{}
+
+// Marshal 编码
+func (gobCodec) Marshal(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobBox{V: plainValue(value)}); err != nil {
+		return nil, fmt.Errorf("gob: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal 解码
+func (gobCodec) Unmarshal(data []byte) (jsonx.JValue, error) {
+	var box gobBox
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&box); err != nil {
+		return nil, fmt.Errorf("gob: %w", err)
+	}
+	return numberValue(box.V), nil
+}
+
+// rawCodec 原样存储[]byte与字符串，读取为JStr
+type rawCodec struct{}
+
+// Marshal 编码
+func (rawCodec) Marshal(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case jsonx.JStr:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("raw codec: unsupported type %T", value)
+}
+
+// Unmarshal 解码
+func (rawCodec) Unmarshal(data []byte) (jsonx.JValue, error) {
+	return jsonx.NewJStr(string(data)), nil
+}
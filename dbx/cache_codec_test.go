@@ -0,0 +1,125 @@
+package dbx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCodecs(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	obj := jsonx.JObj{"name": "tom", "age": 18, "score": 9.5, "ok": true,
+		"tags": []any{"a", 1}, "addr": map[string]any{"zip": 100000}}
+	for _, name := range []string{"json", "msgpack", "gob"} {
+		for _, compress := range []bool{false, true} {
+			conf := CacheConf{"addr": srv.Addr(), "codec": name, "compress": compress, "compress_min": 16}
+			rc, err := NewRedisCache(ctx, conf)
+			assert.NoError(t, err)
+			for typ, c := range map[string]ICache{"mem": NewMemCache(ctx, conf), "redis": rc} {
+				assert.NoError(t, c.Set(ctx, "obj", &obj), name, typ)
+				val, err := c.Get(ctx, "obj")
+				assert.NoError(t, err, name, typ)
+				got := val.ToObj()
+				assert.Equal(t, "tom", got.GetStr("name"), name, typ)
+				assert.Equal(t, jsonx.NewJInt(18), got.GetVal("age"), name, typ)
+				assert.Equal(t, 9.5, got.GetDouble("score"), name, typ)
+				assert.True(t, got.GetBool("ok"), name, typ)
+				assert.Equal(t, int64(100000), got.GetObj("addr").GetLong("zip"), name, typ)
+
+				// 整数保持十进制文本，Incr可用
+				assert.NoError(t, c.Set(ctx, "n", 1))
+				n, err := c.Incr(ctx, "n")
+				assert.NoError(t, err, name, typ)
+				assert.Equal(t, int64(2), n)
+			}
+			raw, err := srv.Get("obj")
+			assert.NoError(t, err)
+			assert.Equal(t, hdrMagic, raw[0]&hdrMagicMask, name)
+			assert.Equal(t, compress, raw[0]&hdrGzip != 0, name)
+			rc.Close(ctx)
+		}
+	}
+}
+
+func TestCacheCodecRollout(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	legacy, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	defer legacy.Close(ctx)
+	packed, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr(), "codec": "msgpack", "compress": true, "compress_min": 64})
+	assert.NoError(t, err)
+	defer packed.Close(ctx)
+
+	// 未配置时仍写无头JSON
+	assert.NoError(t, legacy.Set(ctx, "old", jsonx.JObj{"v": 1}))
+	raw, _ := srv.Get("old")
+	assert.Equal(t, `{"v":1}`, raw)
+
+	// 新旧编码可互相读取
+	big := strings.Repeat("x", 1024)
+	assert.NoError(t, packed.SetEx(ctx, "new", jsonx.JObj{"v": big}, time.Minute))
+	raw, _ = srv.Get("new")
+	assert.Less(t, len(raw), 128)
+	val, err := legacy.Get(ctx, "new")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val.ToObj().GetStr("v"))
+	val, err = packed.Get(ctx, "old")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), val.ToObj().GetLong("v"))
+	vals, err := legacy.MGet(ctx, "old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, big, vals["new"].ToObj().GetStr("v"))
+
+	// 其他客户端写入的非JSON文本
+	assert.NoError(t, srv.Set("plain", "hello world"))
+	val, err = packed.Get(ctx, "plain")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("hello world"), val)
+}
+
+func TestRawCodec(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemCache(ctx, CacheConf{"codec": "raw"})
+	assert.NoError(t, c.Set(ctx, "a", []byte("bytes")))
+	assert.NoError(t, c.Set(ctx, "b", "text"))
+	val, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("bytes"), val)
+	assert.Error(t, c.Set(ctx, "c", jsonx.JObj{}))
+}
+
+func TestCodecConf(t *testing.T) {
+	_, err := newValueCodec(CacheConf{"codec": "xml"})
+	assert.Error(t, err)
+	vc, err := newValueCodec(CacheConf{})
+	assert.NoError(t, err)
+	assert.False(t, vc.header)
+	vc, err = newValueCodec(CacheConf{"compress": true})
+	assert.NoError(t, err)
+	assert.Equal(t, codecJSON, vc.id)
+	assert.Equal(t, 1024, vc.compressMin)
+
+	assert.Error(t, RegisterCodec("dup", codecGob, rawCodec{}))
+	assert.Error(t, RegisterCodec("big", 8, rawCodec{}))
+	assert.NoError(t, RegisterCodec("raw2", 7, rawCodec{}))
+	t.Cleanup(func() {
+		codecMutex.Lock()
+		defer codecMutex.Unlock()
+		delete(codecIDs, "raw2")
+		delete(codecs, 7)
+	})
+	assert.Error(t, RegisterCodec("raw3", 7, rawCodec{}))
+	vc, err = newValueCodec(CacheConf{"codec": "raw2"})
+	assert.NoError(t, err)
+	data, err := vc.encode("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("abc"), decodeValue(data))
+}
@@ -0,0 +1,181 @@
+package dbx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCacheRestart(t *testing.T) {
+	ctx := context.Background()
+	conf := CacheConf{"dir": t.TempDir()}
+	c, err := NewFileCache(ctx, conf)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set(ctx, "user:1", jsonx.JObj{"name": "tom"}, WithTags("user")))
+	assert.NoError(t, c.SetEx(ctx, "short", 1, 10*time.Millisecond))
+	assert.NoError(t, c.SetEx(ctx, "long", 1, time.Hour))
+	lock, err := LockCache(ctx, c, "job", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock(ctx))
+	assert.NoError(t, c.Close(ctx))
+	time.Sleep(20 * time.Millisecond)
+
+	c, err = NewFileCache(ctx, conf)
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	val, err := c.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "tom", val.ToObj().GetStr("name"))
+	assert.False(t, c.Has(ctx, "short"))
+	ttl, err := c.TTL(ctx, "long")
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	// 标签与fencing token都随文件恢复
+	next, err := LockCache(ctx, c, "job", time.Minute)
+	assert.NoError(t, err)
+	assert.Greater(t, next.Token(), lock.Token())
+	n, err := c.InvalidateTags(ctx, "user")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.False(t, c.Has(ctx, "user:1"))
+}
+
+func TestFileCacheCrashRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := NewFileCache(ctx, CacheConf{"dir": dir})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set(ctx, "torn", strings.Repeat("x", 100)))
+	assert.NoError(t, c.Set(ctx, "ok", "v"))
+	assert.NoError(t, c.Close(ctx))
+
+	// 模拟崩溃：残留临时文件、写了一半的值、无法解析的元数据
+	tmp := c.path("ok") + ".123" + fileTmpSuffix
+	assert.NoError(t, os.WriteFile(tmp, []byte("partial"), 0o644))
+	garbage := c.path("garbage")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(garbage), 0o755))
+	assert.NoError(t, os.WriteFile(garbage, []byte("not a cache file"), 0o644))
+	torn := c.path("torn")
+	content, err := os.ReadFile(torn)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(torn, content[:len(content)-10], 0o644))
+
+	c, err = NewFileCache(ctx, CacheConf{"dir": dir})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	assert.NoFileExists(t, tmp)
+	assert.NoFileExists(t, garbage)
+	_, err = c.Get(ctx, "torn")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	assert.NoFileExists(t, torn)
+	val, err := c.Get(ctx, "ok")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("v"), val)
+}
+
+func TestFileCacheDirLock(t *testing.T) {
+	ctx := context.Background()
+	conf := CacheConf{"dir": t.TempDir()}
+	c, err := NewFileCache(ctx, conf)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set(ctx, "k", "v"))
+
+	// 同一目录同时只能由一个实例打开，关闭后可再次打开，锁文件不被当作缓存项清理
+	_, err = NewFileCache(ctx, conf)
+	assert.ErrorContains(t, err, "used by another instance")
+	assert.NoError(t, c.Close(ctx))
+	assert.NoError(t, c.Close(ctx))
+
+	// 关闭后锁已释放，不再读写目录
+	assert.ErrorIs(t, c.Set(ctx, "k", "w"), ErrCacheClosed)
+	_, err = c.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrCacheClosed)
+	_, err = c.Del(ctx, "k")
+	assert.ErrorIs(t, err, ErrCacheClosed)
+	_, err = LockCache(ctx, c, "job", time.Minute)
+	assert.ErrorIs(t, err, ErrCacheClosed)
+	assert.False(t, c.Has(ctx, "k"))
+
+	c, err = NewFileCache(ctx, conf)
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	assert.FileExists(t, filepath.Join(conf.GetStr("dir"), fileLockName))
+	assert.True(t, c.Has(ctx, "k"))
+}
+
+func TestFileCacheForeignFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// 目录中不属于缓存布局的文件，包括同名后缀与两位hex子目录下的其他文件
+	foreign := []string{"notes.txt", "data.tmp", filepath.Join("sub", "data.tmp"), filepath.Join("sub", "ab", "cd"),
+		filepath.Join("ab", "garbage"), filepath.Join("ab", "garbage.tmp"), filepath.Join("ab", strings.Repeat("0", 32))}
+	for _, name := range foreign {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte("user data"), 0o644))
+	}
+	c, err := NewFileCache(ctx, CacheConf{"dir": dir})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set(ctx, "k", "v"))
+	assert.NoError(t, c.Close(ctx))
+	c, err = NewFileCache(ctx, CacheConf{"dir": dir})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	for _, name := range foreign {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+	assert.True(t, c.Has(ctx, "k"))
+	assert.Equal(t, int64(1), c.Stats().Items)
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	value := strings.Repeat("x", 100)
+	c, err := NewFileCache(ctx, CacheConf{"dir": dir, "max_bytes": 500})
+	assert.NoError(t, err)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, c.Set(ctx, key, value))
+	}
+	assert.True(t, c.Has(ctx, "a")) // a变为最近访问
+	assert.NoError(t, c.Set(ctx, "d", value))
+	assert.False(t, c.Has(ctx, "b"))
+	assert.NoFileExists(t, c.path("b"))
+	for _, key := range []string{"a", "c", "d"} {
+		assert.True(t, c.Has(ctx, key), key)
+	}
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, int64(3), stats.Items)
+	assert.LessOrEqual(t, stats.Bytes, int64(500))
+	assert.NoError(t, c.Close(ctx))
+
+	// 调小容量后重启，按写入时间淘汰
+	c, err = NewFileCache(ctx, CacheConf{"dir": dir, "max_bytes": 200})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	assert.Equal(t, int64(1), c.Stats().Items)
+	assert.True(t, c.Has(ctx, "d"))
+}
+
+func TestCacheMgrFileCache(t *testing.T) {
+	ctx := context.Background()
+	cm := &CacheMgr{cacheMap: map[string]ICache{}, confMap: map[string]CacheConf{}}
+	assert.NoError(t, cm.Init(ctx, map[string]CacheConf{"disk": {"type": "file", "dir": t.TempDir(), "codec": "msgpack"}}))
+	defer cm.CloseAll(ctx)
+	c, err := cm.Use("disk")
+	assert.NoError(t, err)
+	assert.IsType(t, &FileCache{}, c)
+	assert.NoError(t, c.Set(ctx, "k", jsonx.JObj{"n": 1}))
+	val, err := c.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), val.ToObj().GetLong("n"))
+}
@@ -0,0 +1,167 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 回源数据不存在；loader返回该错误(或ErrNoRows、sql.ErrNoRows、gorm.ErrRecordNotFound)时可按WithNegativeTTL缓存
+var ErrNotFound = errors.New("dbx: not found")
+
+// Loader 回源函数
+type Loader func(ctx context.Context) (any, error)
+
+// loadOpts GetOrLoad选项
+type loadOpts struct {
+	negativeTTL time.Duration
+	jitter      float64
+	stale       time.Duration
+	timeout     time.Duration
+}
+
+// LoadOpt GetOrLoad选项
+type LoadOpt func(*loadOpts)
+
+// WithNegativeTTL 缓存不存在的结果ttl时长，防止不存在的键反复穿透到数据库
+func WithNegativeTTL(ttl time.Duration) LoadOpt {
+	return func(o *loadOpts) { o.negativeTTL = ttl }
+}
+
+// WithJitter 在ttl基础上随机增加[0, ratio*ttl)，避免同批写入的键同时过期
+func WithJitter(ratio float64) LoadOpt {
+	return func(o *loadOpts) { o.jitter = ratio }
+}
+
+// WithStale 过期后window内仍返回旧值，同时在后台回源刷新
+func WithStale(window time.Duration) LoadOpt {
+	return func(o *loadOpts) { o.stale = window }
+}
+
+// WithLoadTimeout 回源超时，默认30秒；回源由并发的调用方共享，不受单个调用方ctx取消的影响
+func WithLoadTimeout(timeout time.Duration) LoadOpt {
+	return func(o *loadOpts) { o.timeout = timeout }
+}
+
+// loadGroup 合并进程内同一缓存同一键的并发回源
+var loadGroup singleflight.Group
+
+// GetOrLoad 读取缓存，未命中时调用loader回源并写入缓存；同一进程内同一键的并发未命中只回源一次。
+// 缓存值包装为{"v": 值, "s": 软过期毫秒, "m": 是否不存在}，这些键只应通过GetOrLoad读写；
+// 数据不存在时返回包装了ErrNotFound的错误，缓存读写失败时降级为直接回源
+//
+//	val, err := dbx.GetOrLoad(ctx, cache, "user:"+id, time.Minute, func(ctx context.Context) (any, error) {
+//		return repo.Get(ctx, id)
+//	}, dbx.WithNegativeTTL(10*time.Second), dbx.WithStale(time.Minute))
+func GetOrLoad(ctx context.Context, cache ICache, key string, ttl time.Duration, loader Loader, opts ...LoadOpt) (jsonx.JValue, error) {
+	o := &loadOpts{timeout: 30 * time.Second}
+	for _, opt := range opts {
+		opt(o)
+	}
+	val, err := cache.Get(ctx, key)
+	if err == nil {
+		entry := val.ToObj()
+		if entry.GetBool("m") {
+			return jsonx.JNull{}, fmt.Errorf("key %s: %w", key, ErrNotFound)
+		}
+		if soft := entry.GetLong("s"); soft > 0 && time.Now().UnixMilli() > soft {
+			// 软过期：返回旧值并在后台刷新
+			go loadOnce(context.WithoutCancel(ctx), cache, key, ttl, loader, o)
+		}
+		return entry.GetVal("v"), nil
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		logx.WarnfM(ctx, "CacheMgr", "get %s failed, load directly: %v", key, err)
+	}
+	return loadOnce(ctx, cache, key, ttl, loader, o)
+}
+
+// loadOnce 经singleflight回源并写入缓存；回源使用脱离调用方的ctx，调用方ctx结束时只停止等待
+func loadOnce(ctx context.Context, cache ICache, key string, ttl time.Duration, loader Loader, o *loadOpts) (jsonx.JValue, error) {
+	ch := loadGroup.DoChan(fmt.Sprintf("%p:%s", cache, key), func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.timeout)
+		defer cancel()
+		start := time.Now()
+		val, err := loader(ctx)
+		recordLoad(cache, time.Since(start), err)
+		if isNotFound(err) {
+			if o.negativeTTL > 0 {
+				storeEntry(ctx, cache, key, jsonx.JObj{"m": true}, o.negativeTTL)
+			}
+			return nil, fmt.Errorf("key %s: %w: %w", key, ErrNotFound, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 按缓存项的形式经JSON往返，保证与命中缓存时返回的值一致
+		jv := decodeValue(jsonx.UnsafeMarshal(jsonx.JObj{"v": val})).ToObj().GetVal("v")
+		expiration := ttl
+		if o.jitter > 0 && ttl > 0 {
+			expiration += time.Duration(rand.Int64N(int64(float64(ttl)*o.jitter) + 1))
+		}
+		entry := jsonx.JObj{"v": jv}
+		if o.stale > 0 && expiration > 0 {
+			entry["s"] = time.Now().Add(expiration).UnixMilli()
+			expiration += o.stale
+		}
+		storeEntry(ctx, cache, key, entry, expiration)
+		return jv, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return jsonx.JNull{}, res.Err
+		}
+		return res.Val.(jsonx.JValue), nil
+	case <-ctx.Done():
+		return jsonx.JNull{}, ctx.Err()
+	}
+}
+
+// storeEntry 写入缓存，失败只记录日志
+func storeEntry(ctx context.Context, cache ICache, key string, entry jsonx.JObj, expiration time.Duration) {
+	var err error
+	if expiration > 0 {
+		err = cache.SetEx(ctx, key, entry, expiration)
+	} else {
+		err = cache.Set(ctx, key, entry)
+	}
+	if err != nil {
+		logx.WarnfM(ctx, "CacheMgr", "set %s failed: %v", key, err)
+	}
+}
+
+// isNotFound 是否为数据不存在的错误
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrNoRows) || errors.Is(err, sql.ErrNoRows) ||
+		errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// GetOrLoadAs GetOrLoad的泛型版本，结果按JSON解码为T
+//
+//	user, err := dbx.GetOrLoadAs(ctx, cache, "user:"+id, time.Minute, func(ctx context.Context) (*User, error) {
+//		return repo.Get(ctx, id)
+//	})
+func GetOrLoadAs[T any](ctx context.Context, cache ICache, key string, ttl time.Duration,
+	loader func(ctx context.Context) (T, error), opts ...LoadOpt) (T, error) {
+	var out T
+	val, err := GetOrLoad(ctx, cache, key, ttl, func(ctx context.Context) (any, error) {
+		return loader(ctx)
+	}, opts...)
+	if err != nil {
+		return out, err
+	}
+	if err := jsonx.JV2Struct(val, &out); err != nil {
+		return out, fmt.Errorf("key %s: decode %T: %v", key, out, err)
+	}
+	return out, nil
+}
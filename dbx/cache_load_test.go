@@ -0,0 +1,182 @@
+package dbx
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGetOrLoadSingleflight(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemCache(ctx, jsonx.JObj{})
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return jsonx.JObj{"id": 1, "name": "tom"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := GetOrLoad(ctx, cache, "user:1", time.Minute, loader)
+			assert.NoError(t, err)
+			assert.Equal(t, "tom", val.ToObj().GetStr("name"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+
+	// 命中缓存与回源返回相同的值
+	loaded, err := GetOrLoad(ctx, cache, "user:2", time.Minute, loader)
+	assert.NoError(t, err)
+	cached, err := GetOrLoad(ctx, cache, "user:2", time.Minute, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, loaded, cached)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestGetOrLoadCancel(t *testing.T) {
+	cache := NewMemCache(context.Background(), jsonx.JObj{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (any, error) {
+		select {
+		case <-release:
+			return "v", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// 调用方ctx结束时立即返回，共享的回源继续执行并写入缓存
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := GetOrLoad(ctx, cache, "k", time.Minute, loader)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	done := make(chan error, 1)
+	go func() {
+		val, err := GetOrLoad(context.Background(), cache, "k", time.Minute, loader)
+		if err == nil {
+			assert.Equal(t, jsonx.NewJStr("v"), val)
+		}
+		done <- err
+	}()
+	close(release)
+	assert.NoError(t, <-done)
+	assert.True(t, cache.Has(context.Background(), "k"))
+
+	// 回源有自己的超时
+	_, err = GetOrLoad(context.Background(), cache, "slow", time.Minute, func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithLoadTimeout(10*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGetOrLoadNegative(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemCache(ctx, jsonx.JObj{})
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		return nil, gorm.ErrRecordNotFound
+	}
+	for i := 0; i < 3; i++ {
+		_, err := GetOrLoad(ctx, cache, "user:404", time.Minute, loader, WithNegativeTTL(time.Minute))
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	// 未开启负缓存时每次回源
+	for i := 0; i < 2; i++ {
+		_, err := GetOrLoad(ctx, cache, "user:405", time.Minute, loader)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+
+	// QueryOne无结果时的ErrNoRows同样视为不存在，不计入回源失败
+	db := NewSQLite("neg", &jsonx.JObj{"db_url": "sqlite://:memory:"})
+	assert.NoError(t, db.Connect(ctx))
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY)")
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = GetOrLoad(ctx, cache, "user:406", time.Minute, func(ctx context.Context) (any, error) {
+			calls.Add(1)
+			return QueryOne[struct{ ID int64 }](ctx, db, "SELECT id FROM users WHERE id = ?", 406)
+		}, WithNegativeTTL(time.Minute))
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int32(4), calls.Load()) // 第二次命中负缓存
+	assert.Equal(t, int64(0), cache.Stats().LoadErrors)
+}
+
+func TestGetOrLoadStale(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemCache(ctx, jsonx.JObj{})
+	var version atomic.Int64
+	loader := func(ctx context.Context) (any, error) {
+		return version.Add(1), nil
+	}
+	val, err := GetOrLoad(ctx, cache, "cfg", 20*time.Millisecond, loader, WithStale(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJInt(1), val)
+	ttl, err := cache.TTL(ctx, "cfg")
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 50*time.Second)
+
+	time.Sleep(30 * time.Millisecond)
+	val, err = GetOrLoad(ctx, cache, "cfg", 20*time.Millisecond, loader, WithStale(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJInt(1), val)
+	assert.Eventually(t, func() bool {
+		val, err := GetOrLoad(ctx, cache, "cfg", time.Minute, loader)
+		return err == nil && val.ToLong() >= 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestGetOrLoadJitter(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemCache(ctx, jsonx.JObj{})
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := GetOrLoad(ctx, cache, key, time.Minute, func(ctx context.Context) (any, error) {
+			return key, nil
+		}, WithJitter(0.5))
+		assert.NoError(t, err)
+		ttl, err := cache.TTL(ctx, key)
+		assert.NoError(t, err)
+		assert.Greater(t, ttl, 59*time.Second)
+		assert.LessOrEqual(t, ttl, 90*time.Second)
+	}
+}
+
+func TestGetOrLoadAs(t *testing.T) {
+	type user struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	ctx := context.Background()
+	for name, cache := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			loader := func(ctx context.Context) (*user, error) {
+				calls++
+				return &user{ID: 7, Name: "tom"}, nil
+			}
+			for i := 0; i < 2; i++ {
+				u, err := GetOrLoadAs(ctx, cache, "user:7", time.Minute, loader)
+				assert.NoError(t, err)
+				assert.Equal(t, &user{ID: 7, Name: "tom"}, u)
+			}
+			assert.Equal(t, 1, calls)
+		})
+	}
+}
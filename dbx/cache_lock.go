@@ -0,0 +1,451 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fengzhi09/golibx/logx"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrLockHeld 锁已被其他持有者占用
+	ErrLockHeld = errors.New("dbx: lock held by another owner")
+	// ErrLockLost 锁已过期或被其他持有者获取
+	ErrLockLost = errors.New("dbx: lock lost")
+)
+
+// cacheLocker 支持分布式锁的缓存；lockKey与fenceKey由调用方生成，值为持有者ID
+type cacheLocker interface {
+	// tryLock 获取锁，成功时返回递增的fencing token，被占用时返回0
+	tryLock(ctx context.Context, lockKey, fenceKey, owner string, ttl time.Duration) (int64, error)
+	// unlock 持有者匹配时释放锁
+	unlock(ctx context.Context, lockKey, owner string) (bool, error)
+	// refresh 持有者匹配时续期
+	refresh(ctx context.Context, lockKey, owner string, ttl time.Duration) (bool, error)
+}
+
+// CacheLock 分布式锁句柄
+type CacheLock struct {
+	locker cacheLocker
+	key    string
+	owner  string
+	token  int64
+	ttl    time.Duration
+}
+
+// lockKeys 锁与fencing计数器的键；{key}为Redis Cluster的hash tag，保证两者在同一slot
+func lockKeys(key string) (string, string) {
+	return "dbx:lock:{" + key + "}", "dbx:fence:{" + key + "}"
+}
+
+// lockOpts CacheMgr.Lock选项
+type lockOpts struct {
+	local bool
+}
+
+// LockOpt CacheMgr.Lock选项
+type LockOpt func(*lockOpts)
+
+// WithLocalLock 允许在未配置或已降级为内存的缓存上加锁，此时锁只在进程内互斥，多个副本可同时持有
+func WithLocalLock() LockOpt {
+	return func(o *lockOpts) { o.local = true }
+}
+
+// Lock 在名为cacheName的全局缓存上尝试获取锁，不等待；锁被占用时返回ErrLockHeld
+//
+//	lock, err := dbx.Lock(ctx, "main", "cron:report", time.Minute)
+//	if errors.Is(err, dbx.ErrLockHeld) {
+//		return nil // 其他副本正在执行
+//	}
+//	defer lock.Unlock(ctx)
+func Lock(ctx context.Context, cacheName, key string, ttl time.Duration, opts ...LockOpt) (*CacheLock, error) {
+	return CacheX().Lock(ctx, cacheName, key, ttl, opts...)
+}
+
+// Lock 在缓存上尝试获取锁，见Lock；缓存未配置或Init时降级为内存的，除非传入WithLocalLock，否则返回错误
+func (cm *CacheMgr) Lock(ctx context.Context, cacheName, key string, ttl time.Duration, opts ...LockOpt) (*CacheLock, error) {
+	o := &lockOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.local {
+		if err := cm.checkLockable(cacheName); err != nil {
+			return nil, err
+		}
+	}
+	cache, err := cm.Use(cacheName)
+	if err != nil {
+		return nil, err
+	}
+	return LockCache(ctx, cache, key, ttl)
+}
+
+// checkLockable 未配置的缓存由Use自动创建为MemCache，Init连接失败时也降级为MemCache(标记mode=mem)，
+// 这两种情况下锁只在进程内互斥，调用方以为持有的分布式锁会被其他副本同时持有
+func (cm *CacheMgr) checkLockable(cacheName string) error {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	conf, ok := cm.confMap[cacheName]
+	if !ok {
+		return fmt.Errorf("dbx: lock on unconfigured cache %v would be process-local, use WithLocalLock to allow", cacheName)
+	}
+	if getOrDefault(&conf, "type", "mem") != "mem" && conf.GetStr("mode") == "mem" {
+		return fmt.Errorf("dbx: cache %v fell back to mem, lock would be process-local, use WithLocalLock to allow", cacheName)
+	}
+	return nil
+}
+
+// LockCache 在指定缓存上尝试获取锁；Redis使用SET NX PX，MemCache仅在进程内互斥
+func LockCache(ctx context.Context, cache ICache, key string, ttl time.Duration) (*CacheLock, error) {
+	locker, ok := cache.(cacheLocker)
+	if !ok {
+		return nil, fmt.Errorf("dbx: cache %T does not support lock", cache)
+	}
+	lockKey, fenceKey := lockKeys(key)
+	owner := NewOID().Hex()
+	token, err := locker.tryLock(ctx, lockKey, fenceKey, owner, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", key, err)
+	}
+	if token == 0 {
+		return nil, fmt.Errorf("lock %s: %w", key, ErrLockHeld)
+	}
+	return &CacheLock{locker: locker, key: key, owner: owner, token: token, ttl: ttl}, nil
+}
+
+// Key 锁的键
+func (l *CacheLock) Key() string {
+	return l.key
+}
+
+// Token fencing token，同一个键每次加锁严格递增；写入下游时携带，下游拒绝比已见过的更小的token
+func (l *CacheLock) Token() int64 {
+	return l.token
+}
+
+// Unlock 释放锁；锁已过期或被他人获取时返回ErrLockLost
+func (l *CacheLock) Unlock(ctx context.Context) error {
+	lockKey, _ := lockKeys(l.key)
+	ok, err := l.locker.unlock(ctx, lockKey, l.owner)
+	if err != nil {
+		return fmt.Errorf("unlock %s: %w", l.key, err)
+	}
+	if !ok {
+		return fmt.Errorf("unlock %s: %w", l.key, ErrLockLost)
+	}
+	return nil
+}
+
+// Refresh 按加锁时的ttl续期；锁已过期或被他人获取时返回ErrLockLost
+func (l *CacheLock) Refresh(ctx context.Context) error {
+	lockKey, _ := lockKeys(l.key)
+	ok, err := l.locker.refresh(ctx, lockKey, l.owner, l.ttl)
+	if err != nil {
+		return fmt.Errorf("refresh %s: %w", l.key, err)
+	}
+	if !ok {
+		return fmt.Errorf("refresh %s: %w", l.key, ErrLockLost)
+	}
+	return nil
+}
+
+// lockScript 加锁成功时递增fencing计数器并返回，否则返回0
+var lockScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// unlockScript 持有者匹配时删除
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// refreshScript 持有者匹配时续期
+var refreshScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// lockValue 锁的值，按JSON字符串存储以便Get读取
+func lockValue(owner string) string {
+	return strconv.Quote(owner)
+}
+
+// tryLock 以SET NX PX获取锁
+func (r *RedisCache) tryLock(ctx context.Context, lockKey, fenceKey, owner string, ttl time.Duration) (int64, error) {
+	return lockScript.Run(ctx, r.client, []string{lockKey, fenceKey}, lockValue(owner), ttl.Milliseconds()).Int64()
+}
+
+// unlock 持有者匹配时释放锁
+func (r *RedisCache) unlock(ctx context.Context, lockKey, owner string) (bool, error) {
+	n, err := unlockScript.Run(ctx, r.client, []string{lockKey}, lockValue(owner)).Int64()
+	return n > 0, err
+}
+
+// refresh 持有者匹配时续期
+func (r *RedisCache) refresh(ctx context.Context, lockKey, owner string, ttl time.Duration) (bool, error) {
+	n, err := refreshScript.Run(ctx, r.client, []string{lockKey}, lockValue(owner), ttl.Milliseconds()).Int64()
+	return n > 0, err
+}
+
+// tryLock 进程内加锁；锁与fencing计数器都存于LRU之外，不会被淘汰或定期清理提前释放
+func (c *MemCache) tryLock(ctx context.Context, lockKey, fenceKey, owner string, ttl time.Duration) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.heldLock(lockKey); ok {
+		return 0, nil
+	}
+	c.fences[fenceKey]++
+	c.locks[lockKey] = cacheItem{value: []byte(lockValue(owner)), expiration: expireAt(ttl)}
+	return c.fences[fenceKey], nil
+}
+
+// unlock 持有者匹配时释放锁
+func (c *MemCache) unlock(ctx context.Context, lockKey, owner string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.heldLock(lockKey)
+	if !ok || string(item.value) != lockValue(owner) {
+		return false, nil
+	}
+	delete(c.locks, lockKey)
+	return true, nil
+}
+
+// refresh 持有者匹配时续期
+func (c *MemCache) refresh(ctx context.Context, lockKey, owner string, ttl time.Duration) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.heldLock(lockKey)
+	if !ok || string(item.value) != lockValue(owner) {
+		return false, nil
+	}
+	item.expiration = expireAt(ttl)
+	c.locks[lockKey] = item
+	return true, nil
+}
+
+// heldLock 未过期的锁，调用方需持有写锁
+func (c *MemCache) heldLock(lockKey string) (cacheItem, bool) {
+	item, ok := c.locks[lockKey]
+	if !ok || item.expired(time.Now().UnixNano()) {
+		return cacheItem{}, false
+	}
+	return item, true
+}
+
+// tryLock 进程内加锁，fencing计数器与普通键一样落盘，重启后继续递增
+func (c *FileCache) tryLock(ctx context.Context, lockKey, fenceKey, owner string, ttl time.Duration) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return 0, err
+	}
+	if _, ok := c.load(lockKey); ok {
+		return 0, nil
+	}
+	token, err := c.incrBy(fenceKey, 1)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.write(lockKey, []byte(lockValue(owner)), expireAt(ttl), nil); err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+// unlock 持有者匹配时释放锁
+func (c *FileCache) unlock(ctx context.Context, lockKey, owner string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+	data, _, ok := c.read(lockKey)
+	if !ok || string(data) != lockValue(owner) {
+		return false, nil
+	}
+	c.remove(c.entries[lockKey])
+	return true, nil
+}
+
+// refresh 持有者匹配时续期
+func (c *FileCache) refresh(ctx context.Context, lockKey, owner string, ttl time.Duration) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.checkOpen(); err != nil {
+		return false, err
+	}
+	data, _, ok := c.read(lockKey)
+	if !ok || string(data) != lockValue(owner) {
+		return false, nil
+	}
+	if err := c.write(lockKey, data, expireAt(ttl), nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// tryLock 锁只在Redis上
+func (c *TieredCache) tryLock(ctx context.Context, lockKey, fenceKey, owner string, ttl time.Duration) (int64, error) {
+	return c.remote.tryLock(ctx, lockKey, fenceKey, owner, ttl)
+}
+
+// unlock 锁只在Redis上
+func (c *TieredCache) unlock(ctx context.Context, lockKey, owner string) (bool, error) {
+	return c.remote.unlock(ctx, lockKey, owner)
+}
+
+// refresh 锁只在Redis上
+func (c *TieredCache) refresh(ctx context.Context, lockKey, owner string, ttl time.Duration) (bool, error) {
+	return c.remote.refresh(ctx, lockKey, owner, ttl)
+}
+
+// LeaderElector 基于缓存锁的选主：非主节点定期尝试获取租约，主节点按ttl/3续期；
+// 续期被拒绝，或自上次成功续期发起起2/3·ttl内未能续期时退位，保证在租约到期前失去主节点身份
+type LeaderElector struct {
+	cache    ICache
+	key      string
+	ttl      time.Duration
+	onGain   func(ctx context.Context)
+	onLoss   func()
+	leader   atomic.Bool
+	mutex    sync.Mutex
+	lock     *CacheLock
+	renewAt  time.Time
+	lostLead context.CancelFunc
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewLeaderElector 创建选主器；onGain在新协程中调用，ctx在失去主节点身份时取消，
+// 主节点专属的长期任务应随该ctx退出；onLoss在选主协程中同步调用，两者均可为nil
+func NewLeaderElector(cache ICache, key string, ttl time.Duration, onGain func(ctx context.Context), onLoss func()) (*LeaderElector, error) {
+	if _, ok := cache.(cacheLocker); !ok {
+		return nil, fmt.Errorf("dbx: cache %T does not support lock", cache)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("dbx: leader ttl must be positive")
+	}
+	return &LeaderElector{cache: cache, key: key, ttl: ttl, onGain: onGain, onLoss: onLoss}, nil
+}
+
+// Start 立即尝试一次选主，随后在后台持续选主与续期
+func (e *LeaderElector) Start(ctx context.Context) error {
+	if e.done != nil {
+		return fmt.Errorf("dbx: leader elector %v already started", e.key)
+	}
+	ctx, e.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	e.done = make(chan struct{})
+	e.tick(ctx)
+	go e.loop(ctx)
+	return nil
+}
+
+// IsLeader 当前是否为主节点
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// loop 每ttl/3选主或续期一次
+func (e *LeaderElector) loop(ctx context.Context) {
+	defer close(e.done)
+	ticker := time.NewTicker(max(e.ttl/3, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.tick(ctx)
+		}
+	}
+}
+
+// tick 非主节点尝试获取锁，主节点续期
+func (e *LeaderElector) tick(ctx context.Context) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	// 租约从请求发出时起算，记录发出前的时间
+	start := time.Now()
+	if e.lock == nil {
+		lock, err := LockCache(ctx, e.cache, e.key, e.ttl)
+		if err != nil {
+			if !errors.Is(err, ErrLockHeld) {
+				logx.WarnfM(ctx, "CacheMgr", "leader %s elect failed: %v", e.key, err)
+			}
+			return
+		}
+		e.lock, e.renewAt = lock, start
+		e.leader.Store(true)
+		gainCtx, cancel := context.WithCancel(ctx)
+		e.lostLead = cancel
+		logx.InfofM(ctx, "CacheMgr", "leader %s gained, token %d", e.key, lock.Token())
+		if e.onGain != nil {
+			go e.onGain(gainCtx)
+		}
+		return
+	}
+	// 续期请求阻塞时也须在退位时间点返回
+	refreshCtx, cancel := context.WithDeadline(ctx, e.stepDownAt())
+	err := e.lock.Refresh(refreshCtx)
+	cancel()
+	if err == nil {
+		e.renewAt = start
+		return
+	}
+	// 网络错误时继续重试，但须在租约到期前留出ttl/3余量退位，避免与新的主节点重叠
+	if !errors.Is(err, ErrLockLost) && time.Now().Before(e.stepDownAt()) {
+		logx.WarnfM(ctx, "CacheMgr", "leader %s renew failed: %v", e.key, err)
+		return
+	}
+	logx.WarnfM(ctx, "CacheMgr", "leader %s lost: %v", e.key, err)
+	e.lose()
+}
+
+// stepDownAt 未能续期时的退位时间点
+func (e *LeaderElector) stepDownAt() time.Time {
+	return e.renewAt.Add(e.ttl - e.ttl/3)
+}
+
+// lose 清除主节点状态并通知，调用方需持有mutex
+func (e *LeaderElector) lose() {
+	e.lock = nil
+	e.leader.Store(false)
+	e.lostLead()
+	if e.onLoss != nil {
+		e.onLoss()
+	}
+}
+
+// Stop 停止选主；为主节点时释放锁并调用onLoss
+func (e *LeaderElector) Stop(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+	<-e.done
+	e.cancel, e.done = nil, nil
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.lock == nil {
+		return nil
+	}
+	err := e.lock.Unlock(ctx)
+	e.lose()
+	return err
+}
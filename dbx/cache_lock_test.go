@@ -0,0 +1,159 @@
+package dbx
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLock(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			lock, err := LockCache(ctx, c, "cron:report", time.Minute)
+			assert.NoError(t, err)
+			_, err = LockCache(ctx, c, "cron:report", time.Minute)
+			assert.ErrorIs(t, err, ErrLockHeld)
+			assert.NoError(t, lock.Refresh(ctx))
+			assert.NoError(t, lock.Unlock(ctx))
+			assert.ErrorIs(t, lock.Unlock(ctx), ErrLockLost)
+			assert.ErrorIs(t, lock.Refresh(ctx), ErrLockLost)
+
+			// fencing token严格递增
+			next, err := LockCache(ctx, c, "cron:report", time.Minute)
+			assert.NoError(t, err)
+			assert.Greater(t, next.Token(), lock.Token())
+			assert.NoError(t, next.Unlock(ctx))
+		})
+	}
+}
+
+func TestCacheLockExpired(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemCache(ctx, jsonx.JObj{})
+	lock, err := LockCache(ctx, mem, "job", 10*time.Millisecond)
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	other, err := LockCache(ctx, mem, "job", time.Minute)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, lock.Unlock(ctx), ErrLockLost)
+	assert.NoError(t, other.Unlock(ctx))
+
+	srv := miniredis.RunT(t)
+	rc, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	defer rc.Close(ctx)
+	lock, err = LockCache(ctx, rc, "job", time.Second)
+	assert.NoError(t, err)
+	lockKey, _ := lockKeys("job")
+	assert.Equal(t, time.Second, srv.TTL(lockKey))
+	srv.FastForward(2 * time.Second)
+	assert.ErrorIs(t, lock.Refresh(ctx), ErrLockLost)
+
+	cm := &CacheMgr{cacheMap: map[string]ICache{"redis": rc}, confMap: map[string]CacheConf{"redis": {"type": "redis"}}}
+	lock, err = cm.Lock(ctx, "redis", "job", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), lock.Token())
+}
+
+func TestMemCacheLockClean(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewMemCache(ctx, CacheConf{"clean_sec": 1})
+	lock, err := LockCache(ctx, c, "job", time.Minute)
+	assert.NoError(t, err)
+
+	// 两次定期清理后锁仍被持有
+	time.Sleep(2300 * time.Millisecond)
+	_, err = LockCache(ctx, c, "job", time.Minute)
+	assert.ErrorIs(t, err, ErrLockHeld)
+	assert.NoError(t, lock.Refresh(ctx))
+	assert.NoError(t, lock.Unlock(ctx))
+}
+
+func TestCacheMgrLock(t *testing.T) {
+	ctx := context.Background()
+	cm := &CacheMgr{cacheMap: map[string]ICache{}, confMap: map[string]CacheConf{}}
+	assert.NoError(t, cm.Init(ctx, map[string]CacheConf{
+		"local": {"type": "mem"},
+		"bad":   {"type": "redis", "addr": "127.0.0.1:1"},
+	}))
+	defer cm.CloseAll(ctx)
+	lock, err := cm.Lock(ctx, "local", "job", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock(ctx))
+
+	// 未配置与降级的缓存上的锁只在进程内互斥，须显式允许
+	for _, name := range []string{"missing", "bad"} {
+		_, err = cm.Lock(ctx, name, "job", time.Minute)
+		assert.ErrorContains(t, err, "WithLocalLock", name)
+		lock, err = cm.Lock(ctx, name, "job", time.Minute, WithLocalLock())
+		assert.NoError(t, err, name)
+		assert.NoError(t, lock.Unlock(ctx), name)
+	}
+}
+
+func TestLeaderElectorStepDown(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	c, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	ttl := 300 * time.Millisecond
+	var lostAt atomic.Int64
+	e, err := NewLeaderElector(c, "leader:cron", ttl, nil, func() { lostAt.Store(time.Now().UnixNano()) })
+	assert.NoError(t, err)
+	assert.NoError(t, e.Start(ctx))
+	defer e.Stop(ctx)
+	assert.True(t, e.IsLeader())
+
+	// Redis不可用时须在上次续期的租约到期前退位
+	srv.Close()
+	assert.Eventually(t, func() bool { return lostAt.Load() > 0 }, time.Second, 5*time.Millisecond)
+	assert.False(t, e.IsLeader())
+	e.mutex.Lock()
+	leaseEnd := e.renewAt.Add(ttl)
+	e.mutex.Unlock()
+	assert.Less(t, lostAt.Load(), leaseEnd.UnixNano())
+}
+
+func TestLeaderElector(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	newElector := func(gains, losses *atomic.Int32) *LeaderElector {
+		c, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+		assert.NoError(t, err)
+		t.Cleanup(func() { c.Close(ctx) })
+		e, err := NewLeaderElector(c, "leader:cron", 90*time.Millisecond,
+			func(ctx context.Context) { gains.Add(1) }, func() { losses.Add(1) })
+		assert.NoError(t, err)
+		return e
+	}
+	var gainsA, lossesA, gainsB, lossesB atomic.Int32
+	a := newElector(&gainsA, &lossesA)
+	b := newElector(&gainsB, &lossesB)
+	assert.NoError(t, a.Start(ctx))
+	assert.NoError(t, b.Start(ctx))
+	assert.True(t, a.IsLeader())
+	assert.False(t, b.IsLeader())
+	assert.Eventually(t, func() bool { return gainsA.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	// a主动退出后b接任
+	assert.NoError(t, a.Stop(ctx))
+	assert.Equal(t, int32(1), lossesA.Load())
+	assert.Eventually(t, b.IsLeader, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return gainsB.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	// 锁被他人占用时b续期失败并失去身份
+	lockKey, _ := lockKeys("leader:cron")
+	assert.NoError(t, srv.Set(lockKey, `"other"`))
+	assert.Eventually(t, func() bool { return lossesB.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.False(t, b.IsLeader())
+	assert.NoError(t, b.Stop(ctx))
+}
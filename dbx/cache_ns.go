@@ -0,0 +1,278 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// nsKeyPrefix 命名空间版本号的键前缀
+const nsKeyPrefix = "dbx:ns:"
+
+// NSCache 带版本前缀的键命名空间，实际键为"名称:版本:键"；
+// Flush递增版本即可O(1)清空整个命名空间，旧键不再可见，随过期或淘汰回收。标签不加前缀，跨命名空间生效
+type NSCache struct {
+	cache ICache
+	name  string
+}
+
+// NewNSCache 在cache上创建命名空间
+func NewNSCache(cache ICache, name string) *NSCache {
+	return &NSCache{cache: cache, name: name}
+}
+
+// Namespace 获取缓存上的命名空间
+func (cm *CacheMgr) Namespace(cacheName, ns string) (*NSCache, error) {
+	cache, err := cm.Use(cacheName)
+	if err != nil {
+		return nil, err
+	}
+	return NewNSCache(cache, ns), nil
+}
+
+// nsVersioner 在缓存项之外保存版本号的缓存，版本号不随淘汰与定期清理丢失
+type nsVersioner interface {
+	// nsVersion 当前版本号，不存在时初始化
+	nsVersion(verKey string) int64
+	// nsFlush 递增版本号
+	nsFlush(verKey string) int64
+}
+
+// Version 当前版本号；首次使用时以当前纳秒时间初始化，版本键被淘汰后也不会与旧版本重复
+func (n *NSCache) Version(ctx context.Context) (int64, error) {
+	verKey := nsKeyPrefix + n.name
+	if v, ok := n.cache.(nsVersioner); ok {
+		return v.nsVersion(verKey), nil
+	}
+	val, err := n.cache.Get(ctx, verKey)
+	if err == nil {
+		return val.ToLong(), nil
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		return 0, err
+	}
+	if _, err := n.cache.SetNX(ctx, verKey, time.Now().UnixNano(), 0); err != nil {
+		return 0, err
+	}
+	// 并发初始化时以先写入者为准
+	val, err = n.cache.Get(ctx, verKey)
+	if err != nil {
+		return 0, err
+	}
+	return val.ToLong(), nil
+}
+
+// Flush 递增版本号，清空整个命名空间
+func (n *NSCache) Flush(ctx context.Context) error {
+	if v, ok := n.cache.(nsVersioner); ok {
+		v.nsFlush(nsKeyPrefix + n.name)
+		return nil
+	}
+	// 先确保版本号已初始化，避免从0开始递增与旧版本重复
+	if _, err := n.Version(ctx); err != nil {
+		return err
+	}
+	_, err := n.cache.Incr(ctx, nsKeyPrefix+n.name)
+	return err
+}
+
+// prefix 当前版本的键前缀
+func (n *NSCache) prefix(ctx context.Context) (string, error) {
+	ver, err := n.Version(ctx)
+	if err != nil {
+		return "", fmt.Errorf("namespace %s: %w", n.name, err)
+	}
+	return fmt.Sprintf("%s:%d:", n.name, ver), nil
+}
+
+// keys 为键加前缀
+func (n *NSCache) keys(ctx context.Context, keys []string) (string, []string, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = prefix + key
+	}
+	return prefix, full, nil
+}
+
+// Has 检查键是否存在
+func (n *NSCache) Has(ctx context.Context, key string) bool {
+	prefix, err := n.prefix(ctx)
+	return err == nil && n.cache.Has(ctx, prefix+key)
+}
+
+// Get 获取值
+func (n *NSCache) Get(ctx context.Context, key string) (jsonx.JValue, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return jsonx.JNull{}, err
+	}
+	return n.cache.Get(ctx, prefix+key)
+}
+
+// Set 设置值
+func (n *NSCache) Set(ctx context.Context, key string, value any, opts ...SetOpt) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return n.cache.Set(ctx, prefix+key, value, opts...)
+}
+
+// SetEx 设置带过期时间的值
+func (n *NSCache) SetEx(ctx context.Context, key string, value any, expiration time.Duration, opts ...SetOpt) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return n.cache.SetEx(ctx, prefix+key, value, expiration, opts...)
+}
+
+// SetNX 键不存在时设置值
+func (n *NSCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return n.cache.SetNX(ctx, prefix+key, value, expiration)
+}
+
+// Del 删除键
+func (n *NSCache) Del(ctx context.Context, keys ...string) (int64, error) {
+	_, full, err := n.keys(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	return n.cache.Del(ctx, full...)
+}
+
+// Expire 重设过期时间
+func (n *NSCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return n.cache.Expire(ctx, prefix+key, expiration)
+}
+
+// TTL 剩余过期时间
+func (n *NSCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return n.cache.TTL(ctx, prefix+key)
+}
+
+// Incr 原子加1
+func (n *NSCache) Incr(ctx context.Context, key string) (int64, error) {
+	return n.IncrBy(ctx, key, 1)
+}
+
+// IncrBy 原子增加n
+func (n *NSCache) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return n.cache.IncrBy(ctx, prefix+key, delta)
+}
+
+// MGet 批量获取
+func (n *NSCache) MGet(ctx context.Context, keys ...string) (map[string]jsonx.JValue, error) {
+	prefix, full, err := n.keys(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := n.cache.MGet(ctx, full...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]jsonx.JValue, len(vals))
+	for key, val := range vals {
+		out[strings.TrimPrefix(key, prefix)] = val
+	}
+	return out, nil
+}
+
+// MSet 批量设置
+func (n *NSCache) MSet(ctx context.Context, values map[string]any, expiration time.Duration) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	full := make(map[string]any, len(values))
+	for key, value := range values {
+		full[prefix+key] = value
+	}
+	return n.cache.MSet(ctx, full, expiration)
+}
+
+// InvalidateTags 按标签删除键，标签不区分命名空间
+func (n *NSCache) InvalidateTags(ctx context.Context, tags ...string) (int64, error) {
+	return n.cache.InvalidateTags(ctx, tags...)
+}
+
+// Scan 遍历当前版本中匹配pattern的键，回调的键不含前缀
+func (n *NSCache) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	prefix, err := n.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return n.cache.Scan(ctx, globEscape(prefix)+pattern, func(key string) error {
+		return fn(strings.TrimPrefix(key, prefix))
+	})
+}
+
+// Close 不关闭底层缓存
+func (n *NSCache) Close(ctx context.Context) error {
+	return nil
+}
+
+// counters 回源统计记在底层缓存上
+func (n *NSCache) counters() *cacheCounters {
+	if cc, ok := n.cache.(countedCache); ok {
+		return cc.counters()
+	}
+	return nil
+}
+
+// nsVersion 版本号存于LRU之外，否则定期清理会删掉版本键，命名空间中未过期的键随之不可见
+func (c *MemCache) nsVersion(verKey string) int64 {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.versions[verKey]; !ok {
+		c.versions[verKey] = time.Now().UnixNano()
+	}
+	return c.versions[verKey]
+}
+
+// nsFlush 递增版本号
+func (c *MemCache) nsFlush(verKey string) int64 {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.versions[verKey]; !ok {
+		c.versions[verKey] = time.Now().UnixNano()
+	}
+	c.versions[verKey]++
+	return c.versions[verKey]
+}
+
+// globEscape 转义glob特殊字符
+func globEscape(s string) string {
+	var sb strings.Builder
+	for _, ch := range s {
+		if strings.ContainsRune(`*?[]\`, ch) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(ch)
+	}
+	return sb.String()
+}
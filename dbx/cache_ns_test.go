@@ -0,0 +1,136 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTags(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, c.SetEx(ctx, "user:42", "tom", time.Minute, WithTags("user:42")))
+			assert.NoError(t, c.SetEx(ctx, "orders:42", 3, time.Hour, WithTags("user:42", "orders")))
+			assert.NoError(t, c.Set(ctx, "feed:42", 1, WithTags("user:42")))
+			assert.NoError(t, c.Set(ctx, "orders:7", 1, WithTags("orders")))
+			assert.NoError(t, c.Set(ctx, "other", 1))
+
+			n, err := c.InvalidateTags(ctx, "user:42")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), n)
+			assert.False(t, c.Has(ctx, "user:42"))
+			assert.False(t, c.Has(ctx, "orders:42"))
+			assert.True(t, c.Has(ctx, "orders:7"))
+			assert.True(t, c.Has(ctx, "other"))
+
+			// 标签集合已删除，再次失效不影响
+			n, err = c.InvalidateTags(ctx, "user:42", "none")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), n)
+			n, err = c.InvalidateTags(ctx, "orders")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+		})
+	}
+}
+
+func TestRedisTagTTL(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	c, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	assert.NoError(t, c.SetEx(ctx, "a", 1, time.Hour, WithTags("t")))
+	assert.NoError(t, c.SetEx(ctx, "b", 1, time.Minute, WithTags("t")))
+	// 标签集合的过期时间不短于其中的键
+	assert.Equal(t, time.Hour, srv.TTL(tagKeyPrefix+"t"))
+	assert.NoError(t, c.Set(ctx, "c", 1, WithTags("t")))
+	assert.Equal(t, time.Duration(0), srv.TTL(tagKeyPrefix+"t"))
+}
+
+func TestTieredCacheTags(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	conf := CacheConf{"addr": srv.Addr()}
+	a, err := NewTieredCache(ctx, conf)
+	assert.NoError(t, err)
+	defer a.Close(ctx)
+	b, err := NewTieredCache(ctx, conf)
+	assert.NoError(t, err)
+	defer b.Close(ctx)
+
+	assert.NoError(t, a.Set(ctx, "user:42", "tom", WithTags("user:42")))
+	_, err = b.Get(ctx, "user:42")
+	assert.NoError(t, err)
+	n, err := a.InvalidateTags(ctx, "user:42")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Eventually(t, func() bool {
+		return !b.Has(ctx, "user:42")
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNSCache(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			ns := NewNSCache(c, "feed")
+			other := NewNSCache(c, "user")
+			assert.NoError(t, ns.Set(ctx, "1", "a"))
+			assert.NoError(t, ns.MSet(ctx, map[string]any{"2": "b", "3": "c"}, time.Minute))
+			assert.NoError(t, other.Set(ctx, "1", "x"))
+			val, err := ns.Get(ctx, "1")
+			assert.NoError(t, err)
+			assert.Equal(t, "a", val.String())
+			vals, err := ns.MGet(ctx, "1", "2", "4")
+			assert.NoError(t, err)
+			assert.Len(t, vals, 2)
+			assert.Contains(t, vals, "2")
+			count := 0
+			assert.NoError(t, ns.Scan(ctx, "*", func(key string) error {
+				assert.Contains(t, []string{"1", "2", "3"}, key)
+				count++
+				return nil
+			}))
+			assert.Equal(t, 3, count)
+
+			ver, err := ns.Version(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, ns.Flush(ctx))
+			next, err := ns.Version(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, ver+1, next)
+			_, err = ns.Get(ctx, "1")
+			assert.ErrorIs(t, err, ErrCacheMiss)
+			assert.False(t, ns.Has(ctx, "2"))
+			// 其他命名空间不受影响
+			val, err = other.Get(ctx, "1")
+			assert.NoError(t, err)
+			assert.Equal(t, "x", val.String())
+		})
+	}
+}
+
+func TestNSCacheMemClean(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewMemCache(ctx, CacheConf{"clean_sec": 1})
+	ns := NewNSCache(c, "feed")
+	ver, err := ns.Version(ctx)
+	assert.NoError(t, err)
+	time.Sleep(1200 * time.Millisecond)
+	assert.NoError(t, ns.SetEx(ctx, "1", "a", time.Hour))
+
+	// 第二次清理删除早于1秒前写入的项，版本号须保留，之后写入的键仍可见
+	time.Sleep(1300 * time.Millisecond)
+	next, err := ns.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ver, next)
+	val, err := ns.Get(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", val.String())
+}
@@ -0,0 +1,156 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/fengzhi09/golibx/logx"
+)
+
+// CacheStats 缓存统计快照，计数自缓存创建起累计；Items/Bytes由MemCache、FileCache与两级缓存的本地层提供，Redis不提供
+type CacheStats struct {
+	Hits        int64         `json:"hits"`
+	Misses      int64         `json:"misses"`
+	Sets        int64         `json:"sets"`
+	Evictions   int64         `json:"evictions"`   // 因容量或清理策略被淘汰
+	Expirations int64         `json:"expirations"` // 因过期被删除
+	Loads       int64         `json:"loads"`       // GetOrLoad回源次数
+	LoadErrors  int64         `json:"load_errors"` // 回源失败次数，不含数据不存在
+	LoadTime    time.Duration `json:"load_time"`   // 回源总耗时
+	Items       int64         `json:"items"`
+	Bytes       int64         `json:"bytes"` // 键与值的字节数
+}
+
+// HitRate 命中率，无访问时为0
+func (s CacheStats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// AvgLoad 平均回源耗时
+func (s CacheStats) AvgLoad() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.LoadTime / time.Duration(s.Loads)
+}
+
+// cacheCounters 并发安全的统计计数
+type cacheCounters struct {
+	hits, misses, sets, evictions, expirations atomic.Int64
+	loads, loadErrors, loadNanos               atomic.Int64
+}
+
+// hit 记录一次读取结果
+func (s *cacheCounters) hit(ok bool) {
+	if ok {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+}
+
+// recordLoad 记录一次回源
+func (s *cacheCounters) recordLoad(cost time.Duration, err error) {
+	s.loads.Add(1)
+	s.loadNanos.Add(int64(cost))
+	if err != nil && !isNotFound(err) {
+		s.loadErrors.Add(1)
+	}
+}
+
+// snapshot 计数快照
+func (s *cacheCounters) snapshot() CacheStats {
+	return CacheStats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Sets:        s.sets.Load(),
+		Evictions:   s.evictions.Load(),
+		Expirations: s.expirations.Load(),
+		Loads:       s.loads.Load(),
+		LoadErrors:  s.loadErrors.Load(),
+		LoadTime:    time.Duration(s.loadNanos.Load()),
+	}
+}
+
+// statsCache 提供统计的缓存
+type statsCache interface {
+	Stats() CacheStats
+}
+
+// countedCache 可记录回源统计的缓存，counters可能返回nil
+type countedCache interface {
+	counters() *cacheCounters
+}
+
+// recordLoad 在支持统计的缓存上记录一次回源
+func recordLoad(cache ICache, cost time.Duration, err error) {
+	if cc, ok := cache.(countedCache); ok {
+		if counters := cc.counters(); counters != nil {
+			counters.recordLoad(cost, err)
+		}
+	}
+}
+
+// Stats 各缓存的统计快照
+func (cm *CacheMgr) Stats() map[string]CacheStats {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	stats := make(map[string]CacheStats, len(cm.cacheMap))
+	for name, cache := range cm.cacheMap {
+		if sc, ok := cache.(statsCache); ok {
+			stats[name] = sc.Stats()
+		}
+	}
+	return stats
+}
+
+// StatsReporter 统计回调
+type StatsReporter func(ctx context.Context, name string, stats CacheStats)
+
+// ReportStats 每interval上报一次各缓存的统计，report为nil时写日志；ctx取消时停止，interval须为正
+func (cm *CacheMgr) ReportStats(ctx context.Context, interval time.Duration, report StatsReporter) error {
+	if interval <= 0 {
+		return fmt.Errorf("dbx: stats interval must be positive, got %v", interval)
+	}
+	if report == nil {
+		report = logStats
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stats := cm.Stats()
+				names := make([]string, 0, len(stats))
+				for name := range stats {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					report(ctx, name, stats[name])
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// logStats 以日志形式上报
+func logStats(ctx context.Context, name string, s CacheStats) {
+	logx.InfofM(ctx, "CacheMgr", "cache %s: hits=%d misses=%d hit_rate=%.2f sets=%d evictions=%d expirations=%d loads=%d load_errors=%d avg_load=%v items=%d bytes=%d",
+		name, s.Hits, s.Misses, s.HitRate(), s.Sets, s.Evictions, s.Expirations, s.Loads, s.LoadErrors, s.AvgLoad(), s.Items, s.Bytes)
+}
+
+// ReportCacheStats 定期上报全局缓存统计
+func ReportCacheStats(ctx context.Context, interval time.Duration, report StatsReporter) error {
+	return CacheX().ReportStats(ctx, interval, report)
+}
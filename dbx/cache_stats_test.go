@@ -0,0 +1,128 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemCacheStats(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemCache(ctx, CacheConf{"max": 2})
+	assert.NoError(t, c.Set(ctx, "a", 1))
+	assert.NoError(t, c.Set(ctx, "b", 2))
+	assert.NoError(t, c.Set(ctx, "a", 3)) // 覆盖不算淘汰
+	assert.NoError(t, c.Set(ctx, "c", 4)) // 超出容量淘汰b
+	_, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+	_, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	vals, err := c.MGet(ctx, "a", "c", "x")
+	assert.NoError(t, err)
+	assert.Len(t, vals, 2)
+
+	assert.NoError(t, c.SetEx(ctx, "c", 5, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, c.Has(ctx, "c"))
+
+	stats := c.Stats()
+	assert.Equal(t, int64(3), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(5), stats.Sets)
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, int64(1), stats.Expirations)
+	assert.Equal(t, int64(1), stats.Items)
+	assert.Equal(t, int64(len("a")+len("3")), stats.Bytes)
+	assert.InDelta(t, 0.6, stats.HitRate(), 0.001)
+}
+
+func TestCacheLoadStats(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			ok := func(ctx context.Context) (any, error) {
+				time.Sleep(2 * time.Millisecond)
+				return "v", nil
+			}
+			_, err := GetOrLoad(ctx, c, "k", time.Minute, ok)
+			assert.NoError(t, err)
+			_, err = GetOrLoad(ctx, c, "k", time.Minute, ok)
+			assert.NoError(t, err)
+			_, err = GetOrLoad(ctx, c, "none", time.Minute, func(ctx context.Context) (any, error) {
+				return nil, ErrNotFound
+			})
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = GetOrLoad(ctx, NewNSCache(c, "ns"), "bad", time.Minute, func(ctx context.Context) (any, error) {
+				return nil, errors.New("db down")
+			})
+			assert.Error(t, err)
+
+			stats := c.(statsCache).Stats()
+			assert.Equal(t, int64(3), stats.Loads)
+			assert.Equal(t, int64(1), stats.LoadErrors)
+			assert.GreaterOrEqual(t, stats.AvgLoad(), time.Millisecond/2)
+			assert.Positive(t, stats.Hits)
+			assert.Positive(t, stats.Sets)
+		})
+	}
+}
+
+func TestTieredCacheStats(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	c, err := NewTieredCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	assert.NoError(t, c.Set(ctx, "a", 1))
+	assert.NoError(t, srv.Set("b", "2"))
+	_, err = c.Get(ctx, "a") // 远端命中并回填本地
+	assert.NoError(t, err)
+	_, err = c.Get(ctx, "a") // 本地命中
+	assert.NoError(t, err)
+	_, err = c.Get(ctx, "x")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	vals, err := c.MGet(ctx, "a", "b", "y")
+	assert.NoError(t, err)
+	assert.Len(t, vals, 2)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(4), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+	assert.Equal(t, int64(1), stats.Sets)
+	assert.Equal(t, int64(2), stats.Items)
+}
+
+func TestCacheMgrStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mem := NewMemCache(ctx, jsonx.JObj{})
+	cm := &CacheMgr{cacheMap: map[string]ICache{"mem": mem, "ns": NewNSCache(mem, "x")}}
+	assert.NoError(t, mem.Set(ctx, "a", 1))
+	_, _ = mem.Get(ctx, "a")
+
+	stats := cm.Stats()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, int64(1), stats["mem"].Hits)
+	assert.Equal(t, int64(1), stats["mem"].Items)
+
+	var mu sync.Mutex
+	reported := map[string]CacheStats{}
+	assert.Error(t, cm.ReportStats(ctx, 0, nil))
+	assert.NoError(t, cm.ReportStats(ctx, 5*time.Millisecond, func(ctx context.Context, name string, stats CacheStats) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported[name] = stats
+	}))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return reported["mem"].Sets == 1
+	}, time.Second, 5*time.Millisecond)
+}
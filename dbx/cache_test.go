@@ -0,0 +1,232 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCaches 内存缓存与基于miniredis的Redis缓存
+func testCaches(t *testing.T) map[string]ICache {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := miniredis.RunT(t)
+	rc, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		cancel()
+		rc.Close(context.Background())
+	})
+	// miniredis单节点响应CLUSTER SLOTS，可用于覆盖集群模式下按键拆分的分支
+	cc, err := NewRedisCache(ctx, CacheConf{"mode": "cluster", "addrs": []any{miniredis.RunT(t).Addr()}})
+	assert.NoError(t, err)
+	t.Cleanup(func() { cc.Close(context.Background()) })
+	fc, err := NewFileCache(ctx, CacheConf{"dir": t.TempDir()})
+	assert.NoError(t, err)
+	t.Cleanup(func() { fc.Close(context.Background()) })
+	return map[string]ICache{"mem": NewMemCache(ctx, CacheConf{}), "redis": rc, "cluster": cc, "file": fc}
+}
+
+func TestCacheOps(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			// SetNX / TTL / Expire
+			ok, err := c.SetNX(ctx, "lock", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = c.SetNX(ctx, "lock", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			ttl, err := c.TTL(ctx, "lock")
+			assert.NoError(t, err)
+			assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+			ok, err = c.Expire(ctx, "lock", 0)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ttl, err = c.TTL(ctx, "lock")
+			assert.NoError(t, err)
+			assert.Equal(t, NoExpiration, ttl)
+			ok, err = c.Expire(ctx, "none", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			_, err = c.TTL(ctx, "none")
+			assert.Error(t, err)
+
+			// Incr保留过期时间，非整数报错
+			n, err := c.Incr(ctx, "cnt")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+			assert.NoError(t, c.SetEx(ctx, "cnt", 10, time.Hour))
+			n, err = c.IncrBy(ctx, "cnt", 5)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(15), n)
+			ttl, err = c.TTL(ctx, "cnt")
+			assert.NoError(t, err)
+			assert.Greater(t, ttl, time.Minute)
+			assert.NoError(t, c.Set(ctx, "str", "x"))
+
+			// SetEx的expiration<=0表示不过期，覆盖原有的过期时间
+			for _, exp := range []time.Duration{0, -1, -time.Second} {
+				assert.NoError(t, c.SetEx(ctx, "forever", "v", time.Minute))
+				assert.NoError(t, c.SetEx(ctx, "forever", "v", exp))
+				assert.True(t, c.Has(ctx, "forever"), exp)
+				ttl, err = c.TTL(ctx, "forever")
+				assert.NoError(t, err)
+				assert.Equal(t, NoExpiration, ttl, exp)
+			}
+			_, err = c.Incr(ctx, "str")
+			assert.Error(t, err)
+
+			// MSet / MGet / Del
+			assert.NoError(t, c.MSet(ctx, map[string]any{"user:1": 1, "user:2": 2, "user:10": 10}, time.Minute))
+			vals, err := c.MGet(ctx, "user:1", "user:2", "user:3")
+			assert.NoError(t, err)
+			assert.Len(t, vals, 2)
+			assert.NotContains(t, vals, "user:3")
+
+			// Scan
+			keys := make([]string, 0)
+			assert.NoError(t, c.Scan(ctx, "user:?", func(key string) error {
+				keys = append(keys, key)
+				return nil
+			}))
+			sort.Strings(keys)
+			assert.Equal(t, []string{"user:1", "user:2"}, keys)
+			count := 0
+			assert.NoError(t, c.Scan(ctx, "user:*", func(key string) error {
+				count++
+				return ErrStopEach
+			}))
+			assert.Equal(t, 1, count)
+
+			n, err = c.Del(ctx, "user:1", "user:2", "user:3")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			assert.False(t, c.Has(ctx, "user:1"))
+		})
+	}
+}
+
+func TestCacheGet(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.Get(ctx, "none")
+			assert.ErrorIs(t, err, ErrCacheMiss)
+			_, err = c.TTL(ctx, "none")
+			assert.ErrorIs(t, err, ErrCacheMiss)
+
+			assert.NoError(t, c.Set(ctx, "null", nil))
+			val, err := c.Get(ctx, "null")
+			assert.NoError(t, err)
+			assert.Equal(t, jsonx.JNull{}, val)
+			assert.NoError(t, c.Set(ctx, "empty", ""))
+			val, err = c.Get(ctx, "empty")
+			assert.NoError(t, err)
+			assert.Equal(t, jsonx.NewJStr(""), val)
+
+			assert.NoError(t, c.MSet(ctx, map[string]any{"int": 5, "num": 1.5, "obj": jsonx.JObj{"name": "tom", "tags": []string{"a"}}}, 0))
+			vals, err := c.MGet(ctx, "int", "num", "obj")
+			assert.NoError(t, err)
+			assert.Equal(t, jsonx.NewJInt(5), vals["int"])
+			assert.Equal(t, jsonx.NewJNum(1.5), vals["num"])
+			obj, err := c.Get(ctx, "obj")
+			assert.NoError(t, err)
+			assert.Equal(t, "tom", obj.ToObj().GetStr("name"))
+			assert.Equal(t, []string{"a"}, obj.ToObj().GetStrArr("tags"))
+		})
+	}
+}
+
+func TestRedisCacheDown(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	c, err := NewRedisCache(ctx, CacheConf{"addr": srv.Addr()})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	assert.NoError(t, srv.Set("raw", "not json"))
+	val, err := c.Get(ctx, "raw")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("not json"), val)
+
+	srv.Close()
+	_, err = c.Get(ctx, "raw")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrCacheMiss))
+}
+
+func TestRedisOptions(t *testing.T) {
+	opts, err := redisOptions(jsonx.ParseObj([]byte(`{"addr":"a:6379","db":2,"pool_size":20,"read_timeout_ms":300}`)), "single")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a:6379"}, opts.Addrs)
+	assert.Equal(t, 2, opts.DB)
+	assert.Equal(t, 20, opts.PoolSize)
+	assert.Equal(t, 300*time.Millisecond, opts.ReadTimeout)
+	assert.Nil(t, opts.TLSConfig)
+
+	opts, err = redisOptions(CacheConf{"addrs": "s1:26379, s2:26379", "master_name": "mymaster", "tls": true, "tls_skip_verify": true}, "sentinel")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"s1:26379", "s2:26379"}, opts.Addrs)
+	assert.Equal(t, "mymaster", opts.MasterName)
+	assert.True(t, opts.TLSConfig.InsecureSkipVerify)
+
+	for mode, conf := range map[string]CacheConf{
+		"single":   {"addrs": []string{"a:1", "b:1"}},
+		"sentinel": {"addr": "a:1"},
+		"cluster":  {"addr": "a:1", "db": 1},
+		"other":    {"addr": "a:1"},
+	} {
+		_, err := redisOptions(conf, mode)
+		assert.Error(t, err, mode)
+	}
+	_, err = redisOptions(CacheConf{}, "single")
+	assert.Error(t, err)
+	_, err = redisOptions(CacheConf{"addr": "a:1", "tls": true, "tls_ca_file": "/nonexistent"}, "single")
+	assert.Error(t, err)
+}
+
+func TestMemCacheExpired(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemCache(ctx, jsonx.JObj{})
+	assert.NoError(t, c.SetEx(ctx, "k", 1, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, c.Has(ctx, "k"))
+	_, err := c.Get(ctx, "k")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	n, err := c.Incr(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	ttl, err := c.TTL(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, NoExpiration, ttl)
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"*:*:end", "a:b:c:end", true},
+		{"[", "[", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, globMatch(c.pattern, c.s), "%s ~ %s", c.pattern, c.s)
+	}
+}
@@ -0,0 +1,145 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	conf := CacheConf{"addr": srv.Addr(), "local_ttl_sec": 60}
+	a, err := NewTieredCache(ctx, conf)
+	assert.NoError(t, err)
+	defer a.Close(ctx)
+	b, err := NewTieredCache(ctx, conf)
+	assert.NoError(t, err)
+	defer b.Close(ctx)
+
+	// b读取后回填本地，Redis中被直接修改时仍读到本地副本
+	// 先等a的失效消息到达b，否则它在b读Redis期间到达时本次回填作废
+	assert.NoError(t, a.SetEx(ctx, "user:1", "tom", time.Hour))
+	assert.Eventually(t, func() bool { return b.gen("user:1").Load() > 0 }, time.Second, 5*time.Millisecond)
+	val, err := b.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("tom"), val)
+	assert.NoError(t, srv.Set("user:1", `"bypass"`))
+	val, err = b.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJStr("tom"), val)
+
+	// a写入后通知b淘汰本地副本
+	assert.NoError(t, a.Set(ctx, "user:1", "jerry"))
+	assert.Eventually(t, func() bool {
+		val, err := b.Get(ctx, "user:1")
+		return err == nil && val.String() == "jerry"
+	}, time.Second, 5*time.Millisecond)
+
+	_, err = a.Del(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := b.Get(ctx, "user:1")
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+	_, err = b.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func TestTieredCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	c, err := NewTieredCache(ctx, CacheConf{"addr": srv.Addr(), "local_ttl_sec": 60, "remote_ttl_sec": 300})
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+
+	assert.NoError(t, c.Set(ctx, "k", 1))
+	assert.Equal(t, 300*time.Second, srv.TTL("k"))
+	assert.NoError(t, c.SetEx(ctx, "short", 1, 10*time.Second))
+	_, err = c.Get(ctx, "short")
+	assert.NoError(t, err)
+	// 本地过期时间不超过Redis剩余时间
+	ttl, err := c.local.TTL(ctx, "short")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, ttl, 10*time.Second)
+	_, err = c.Get(ctx, "k")
+	assert.NoError(t, err)
+	ttl, err = c.local.TTL(ctx, "k")
+	assert.NoError(t, err)
+	assert.InDelta(t, 60*time.Second, ttl, float64(time.Second))
+
+	// MGet回填同样不超过Redis剩余时间
+	assert.NoError(t, c.SetEx(ctx, "m1", 1, 5*time.Second))
+	assert.NoError(t, c.Set(ctx, "m2", 2))
+	vals, err := c.MGet(ctx, "m1", "m2", "none")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]jsonx.JValue{"m1": jsonx.NewJInt(1), "m2": jsonx.NewJInt(2)}, vals)
+	ttl, err = c.local.TTL(ctx, "m1")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, ttl, 5*time.Second)
+	ttl, err = c.local.TTL(ctx, "m2")
+	assert.NoError(t, err)
+	assert.InDelta(t, 60*time.Second, ttl, float64(time.Second))
+
+	n, err := c.Incr(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	val, err := c.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, jsonx.NewJInt(2), val)
+}
+
+func TestCacheMgrFallback(t *testing.T) {
+	ctx := context.Background()
+	cm := &CacheMgr{cacheMap: map[string]ICache{}, confMap: map[string]CacheConf{}}
+	assert.NoError(t, cm.Init(ctx, map[string]CacheConf{
+		"bad":   {"type": "tiered", "addr": "127.0.0.1:1"},
+		"local": {"type": "mem"},
+	}))
+	bad, err := cm.Use("bad")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemCache{}, bad)
+	defer cm.CloseAll(ctx)
+}
+
+func TestTieredCacheBackfillRace(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	conf := CacheConf{"addr": srv.Addr(), "local_ttl_sec": 60}
+	c, err := NewTieredCache(ctx, conf)
+	assert.NoError(t, err)
+	defer c.Close(ctx)
+	other, err := NewTieredCache(ctx, conf)
+	assert.NoError(t, err)
+	defer other.Close(ctx)
+	assert.NoError(t, c.Set(ctx, "k", "old"))
+
+	// 按Get的步骤交错：读到旧值后、回填前本实例写入新值，旧值不得回填
+	gen := c.gen("k").Load()
+	data, ttl, err := c.remote.getRaw(ctx, "k")
+	assert.NoError(t, err)
+	assert.NoError(t, c.SetEx(ctx, "k", "new", time.Hour))
+	c.backfill("k", gen, data, ttl)
+	val, err := c.Get(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", val.String())
+
+	// 其间收到其他实例的失效消息同样放弃回填
+	_, err = c.Del(ctx, "k")
+	assert.NoError(t, err)
+	assert.NoError(t, srv.Set("k", `"old"`))
+	gen = c.gen("k").Load()
+	data, ttl, err = c.remote.getRaw(ctx, "k")
+	assert.NoError(t, err)
+	assert.NoError(t, other.Set(ctx, "k", "newer"))
+	assert.Eventually(t, func() bool { return c.gen("k").Load() != gen }, time.Second, 5*time.Millisecond)
+	c.backfill("k", gen, data, ttl)
+	vals, err := c.MGet(ctx, "k")
+	assert.NoError(t, err)
+	assert.Equal(t, "newer", vals["k"].String())
+}
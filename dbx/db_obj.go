@@ -42,7 +42,7 @@ func HexOID(oid string) OID {
 }
 
 func (j *OID) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -100,7 +100,7 @@ type Json struct {
 
 // 实现 sql.Scanner 接口，Scan 将 value 扫描至 JSONB
 func (j *Json) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -152,7 +152,7 @@ type JsonArr struct {
 
 // 实现 sql.Scanner 接口，Scan 将 value 扫描至 JSONB
 func (j *JsonArr) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -213,7 +213,7 @@ func (sa *StrArr) ToJArr() jsonx.JArr {
 
 // 实现 sql.Scanner 接口，Scan 将 value 扫描至 JSONB
 func (sa *StrArr) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -280,7 +280,7 @@ func (ia *LongArr) ToJArr() jsonx.JArr {
 
 // 实现 sql.Scanner 接口，Scan 将 value 扫描至 JSONB
 func (ia *LongArr) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -347,7 +347,7 @@ func (re *DoubleArr) ToJArr() jsonx.JArr {
 
 // 实现 sql.Scanner 接口，Scan 将 value 扫描至 JSONB
 func (re *DoubleArr) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -395,7 +395,7 @@ type MapI2S map[string]string
 
 // 实现 sql.Scanner 接口，Scan 将 value 扫描至 JSONB
 func (j *MapI2S) Scan(value any) error {
-	str, ok := value.(string)
+	str, ok := scanStr(value)
 	if !ok {
 		return fmt.Errorf("not json str: %v", value)
 	}
@@ -456,3 +456,16 @@ const (
 	CustomerIDOnSql   = "varchar(24)"
 	CustomerTypeOnSql = "text"
 )
+
+// scanStr 统一驱动返回值为字符串: string/[]byte原样返回，pgx解析过的json(map/slice)重新序列化
+func scanStr(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case map[string]any, []any:
+		return jsonx.UnsafeMarshalString(v), true
+	}
+	return "", false
+}
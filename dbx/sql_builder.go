@@ -0,0 +1,547 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// Builder 方言感知的SQL构造器
+//
+//	sql, args, err := dbx.Select("users", "id", "name").
+//		Where(jsonx.JObj{"age": jsonx.JObj{"$gte": 18}, "tag": []any{"a", "b"}}).
+//		OrderBy("-created_at").Limit(10).Build(dbx.DialectPostgres)
+type Builder struct {
+	op        string
+	table     string
+	columns   []string
+	rows      [][]any
+	sets      []setItem
+	conds     []condItem
+	groupBy   []string
+	orderBy   []string
+	limit     int
+	offset    int
+	keys      []string // upsert冲突键
+	updates   []string // upsert冲突时更新的列，为空时更新全部非键列
+	doNothing bool
+}
+
+type setItem struct {
+	column string
+	value  any
+}
+
+type condItem struct {
+	filter jsonx.JObj
+	raw    string
+	args   []any
+}
+
+const (
+	opSelect = "SELECT"
+	opInsert = "INSERT"
+	opUpdate = "UPDATE"
+	opDelete = "DELETE"
+	opUpsert = "UPSERT"
+)
+
+// Select 构造查询，columns为空时查询全部列
+func Select(table string, columns ...string) *Builder {
+	return &Builder{op: opSelect, table: table, columns: columns}
+}
+
+// Insert 构造插入
+func Insert(table string, columns ...string) *Builder {
+	return &Builder{op: opInsert, table: table, columns: columns}
+}
+
+// Update 构造更新
+func Update(table string) *Builder {
+	return &Builder{op: opUpdate, table: table}
+}
+
+// Delete 构造删除
+func Delete(table string) *Builder {
+	return &Builder{op: opDelete, table: table}
+}
+
+// Upsert 构造插入或更新，keys为冲突键(Doris唯一键模型下直接插入即覆盖)
+func Upsert(table string, keys ...string) *Builder {
+	return &Builder{op: opUpsert, table: table, keys: keys}
+}
+
+// Columns 设置列
+func (b *Builder) Columns(columns ...string) *Builder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// Values 追加一行插入值，顺序与Columns一致
+func (b *Builder) Values(values ...any) *Builder {
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// Rows 以JObj追加插入行，未设置Columns时取首行的键(排序后)作为列
+func (b *Builder) Rows(objs ...jsonx.JObj) *Builder {
+	for _, obj := range objs {
+		if len(b.columns) == 0 {
+			b.columns = obj.Keys()
+			sort.Strings(b.columns)
+		}
+		row := make([]any, len(b.columns))
+		for i, col := range b.columns {
+			row[i] = plainVal(obj[col])
+		}
+		b.rows = append(b.rows, row)
+	}
+	return b
+}
+
+// Set 设置更新列
+func (b *Builder) Set(column string, value any) *Builder {
+	b.sets = append(b.sets, setItem{column: column, value: value})
+	return b
+}
+
+// SetObj 以JObj设置更新列(按键排序)
+func (b *Builder) SetObj(obj jsonx.JObj) *Builder {
+	keys := obj.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.Set(key, obj[key])
+	}
+	return b
+}
+
+// OnConflict 设置upsert冲突时更新的列；不调用时更新全部非键列
+func (b *Builder) OnConflict(updates ...string) *Builder {
+	b.updates = updates
+	return b
+}
+
+// DoNothing upsert冲突时忽略
+func (b *Builder) DoNothing() *Builder {
+	b.doNothing = true
+	return b
+}
+
+// Where 追加JObj过滤条件，多次调用以AND连接
+//
+// 支持: {"a":1} {"a":nil} {"a":[1,2]} {"a":{"$gt":1,"$lte":5}} {"$or":[{...},{...}]}；
+// 操作符: $eq $ne $gt $gte $lt $lte $in $nin $like $null；键必须为合法标识符，值一律参数化
+func (b *Builder) Where(filter jsonx.JObj) *Builder {
+	if len(filter) > 0 {
+		b.conds = append(b.conds, condItem{filter: filter})
+	}
+	return b
+}
+
+// WhereRaw 追加原生条件，使用?作为占位符
+func (b *Builder) WhereRaw(expr string, args ...any) *Builder {
+	b.conds = append(b.conds, condItem{raw: expr, args: args})
+	return b
+}
+
+// GroupBy 设置分组
+func (b *Builder) GroupBy(columns ...string) *Builder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// OrderBy 设置排序，"-col"表示降序
+func (b *Builder) OrderBy(columns ...string) *Builder {
+	b.orderBy = append(b.orderBy, columns...)
+	return b
+}
+
+// Limit 设置返回行数
+func (b *Builder) Limit(limit int) *Builder {
+	b.limit = limit
+	return b
+}
+
+// Offset 设置偏移
+func (b *Builder) Offset(offset int) *Builder {
+	b.offset = offset
+	return b
+}
+
+// Query 按db方言构造并执行查询
+func (b *Builder) Query(ctx context.Context, db IQuery) ([]*jsonx.JObj, error) {
+	query, args, err := b.Build(db.Dialect())
+	if err != nil {
+		return nil, err
+	}
+	return db.Query(ctx, query, args...)
+}
+
+// Exec 按db方言构造并执行写操作
+func (b *Builder) Exec(ctx context.Context, db IQuery) (ExecResult, error) {
+	query, args, err := b.Build(db.Dialect())
+	if err != nil {
+		return ExecResult{}, err
+	}
+	return db.Exec(ctx, query, args...)
+}
+
+// Build 生成SQL与参数
+func (b *Builder) Build(d Dialect) (string, []any, error) {
+	r := &render{d: d}
+	if !IsIdent(b.table) {
+		return "", nil, fmt.Errorf("dbx: bad table name %q", b.table)
+	}
+	switch b.op {
+	case opSelect:
+		b.buildSelect(r)
+	case opInsert, opUpsert:
+		b.buildInsert(r)
+	case opUpdate:
+		b.buildUpdate(r)
+	case opDelete:
+		r.sb.WriteString("DELETE FROM " + d.Quote(b.table))
+		b.buildWhere(r, true)
+	}
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return r.sb.String(), r.args, nil
+}
+
+type render struct {
+	d     Dialect
+	sb    strings.Builder
+	args  []any
+	err   error
+	qmark bool // 统一使用?占位符，交由gorm按方言改写
+}
+
+func (r *render) arg(v any) string {
+	r.args = append(r.args, plainVal(v))
+	if r.qmark {
+		return "?"
+	}
+	return r.d.Placeholder(len(r.args))
+}
+
+func (r *render) ident(name string) string {
+	if !IsIdent(name) {
+		if r.err == nil {
+			r.err = fmt.Errorf("dbx: bad identifier %q", name)
+		}
+		return name
+	}
+	return r.d.Quote(name)
+}
+
+func (b *Builder) buildSelect(r *render) {
+	cols := "*"
+	if len(b.columns) > 0 {
+		parts := make([]string, len(b.columns))
+		for i, col := range b.columns {
+			// 非标识符视为开发者提供的表达式，如 count(*) AS n
+			parts[i] = col
+			if IsIdent(col) {
+				parts[i] = r.d.Quote(col)
+			}
+		}
+		cols = strings.Join(parts, ", ")
+	}
+	r.sb.WriteString("SELECT " + cols + " FROM " + r.d.Quote(b.table))
+	b.buildWhere(r, false)
+	if len(b.groupBy) > 0 {
+		parts := make([]string, len(b.groupBy))
+		for i, col := range b.groupBy {
+			parts[i] = r.ident(col)
+		}
+		r.sb.WriteString(" GROUP BY " + strings.Join(parts, ", "))
+	}
+	if len(b.orderBy) > 0 {
+		parts := make([]string, len(b.orderBy))
+		for i, col := range b.orderBy {
+			if strings.HasPrefix(col, "-") {
+				parts[i] = r.ident(col[1:]) + " DESC"
+			} else {
+				parts[i] = r.ident(strings.TrimPrefix(col, "+")) + " ASC"
+			}
+		}
+		r.sb.WriteString(" ORDER BY " + strings.Join(parts, ", "))
+	}
+	if b.limit > 0 {
+		r.sb.WriteString(fmt.Sprintf(" LIMIT %d", b.limit))
+	}
+	if b.offset > 0 {
+		r.sb.WriteString(fmt.Sprintf(" OFFSET %d", b.offset))
+	}
+}
+
+func (b *Builder) buildInsert(r *render) {
+	if len(b.columns) == 0 || len(b.rows) == 0 {
+		r.err = fmt.Errorf("dbx: insert into %v without columns or values", b.table)
+		return
+	}
+	cols := make([]string, len(b.columns))
+	for i, col := range b.columns {
+		cols[i] = r.ident(col)
+	}
+	verb := "INSERT INTO "
+	if b.op == opUpsert && b.doNothing && r.d != DialectPostgres && r.d != DialectSQLite {
+		verb = "INSERT IGNORE INTO "
+	}
+	r.sb.WriteString(verb + r.d.Quote(b.table) + " (" + strings.Join(cols, ", ") + ") VALUES ")
+	for i, row := range b.rows {
+		if len(row) != len(b.columns) {
+			r.err = fmt.Errorf("dbx: insert row %d has %d values, want %d", i, len(row), len(b.columns))
+			return
+		}
+		holders := make([]string, len(row))
+		for j, v := range row {
+			holders[j] = r.arg(v)
+		}
+		if i > 0 {
+			r.sb.WriteString(", ")
+		}
+		r.sb.WriteString("(" + strings.Join(holders, ", ") + ")")
+	}
+	if b.op == opUpsert {
+		b.buildConflict(r)
+	}
+}
+
+func (b *Builder) buildConflict(r *render) {
+	updates := b.updates
+	if len(updates) == 0 {
+		for _, col := range b.columns {
+			if !containsFold(b.keys, col) {
+				updates = append(updates, col)
+			}
+		}
+	}
+	switch r.d {
+	case DialectDoris:
+		// Doris唯一键模型: 相同键的写入直接覆盖
+		if b.doNothing {
+			r.err = fmt.Errorf("dbx: doris does not support upsert do nothing")
+		}
+	case DialectPostgres, DialectSQLite:
+		if len(b.keys) == 0 {
+			r.err = fmt.Errorf("dbx: upsert into %v without conflict keys", b.table)
+			return
+		}
+		keys := make([]string, len(b.keys))
+		for i, key := range b.keys {
+			keys[i] = r.ident(key)
+		}
+		r.sb.WriteString(" ON CONFLICT (" + strings.Join(keys, ", ") + ")")
+		if b.doNothing || len(updates) == 0 {
+			r.sb.WriteString(" DO NOTHING")
+			return
+		}
+		sets := make([]string, len(updates))
+		for i, col := range updates {
+			sets[i] = r.ident(col) + " = EXCLUDED." + r.ident(col)
+		}
+		r.sb.WriteString(" DO UPDATE SET " + strings.Join(sets, ", "))
+	default:
+		if b.doNothing || len(updates) == 0 {
+			return
+		}
+		sets := make([]string, len(updates))
+		for i, col := range updates {
+			sets[i] = r.ident(col) + " = VALUES(" + r.ident(col) + ")"
+		}
+		r.sb.WriteString(" ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "))
+	}
+}
+
+func (b *Builder) buildUpdate(r *render) {
+	if len(b.sets) == 0 {
+		r.err = fmt.Errorf("dbx: update %v without set", b.table)
+		return
+	}
+	sets := make([]string, len(b.sets))
+	for i, item := range b.sets {
+		sets[i] = r.ident(item.column) + " = " + r.arg(item.value)
+	}
+	r.sb.WriteString("UPDATE " + r.d.Quote(b.table) + " SET " + strings.Join(sets, ", "))
+	b.buildWhere(r, true)
+}
+
+// buildWhere 渲染条件；required时无条件视为错误，防止误更新/删除全表
+func (b *Builder) buildWhere(r *render, required bool) {
+	parts := make([]string, 0, len(b.conds))
+	for _, cond := range b.conds {
+		if cond.filter != nil {
+			if expr := r.filter(cond.filter); expr != "" {
+				parts = append(parts, expr)
+			}
+			continue
+		}
+		expr := r.d.Rebind(cond.raw, len(r.args))
+		for _, arg := range cond.args {
+			r.args = append(r.args, plainVal(arg))
+		}
+		parts = append(parts, "("+expr+")")
+	}
+	if len(parts) == 0 {
+		if required && r.err == nil {
+			r.err = fmt.Errorf("dbx: %v %v without where, use WhereRaw(\"1=1\") to confirm", strings.ToLower(b.op), b.table)
+		}
+		return
+	}
+	r.sb.WriteString(" WHERE " + strings.Join(parts, " AND "))
+}
+
+// filter 渲染JObj条件
+func (r *render) filter(filter jsonx.JObj) string {
+	keys := filter.Keys()
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		val := plainVal(filter[key])
+		switch key {
+		case "$or", "$and":
+			// 非列表、空列表或空对象若被忽略会放宽条件，直接报错
+			items := asList(val)
+			if len(items) == 0 {
+				r.fail("dbx: %v expects a non-empty list of objects, got %T", key, val)
+				continue
+			}
+			subs := make([]string, 0, len(items))
+			for _, item := range items {
+				obj, ok := asObj(item)
+				if !ok || len(obj) == 0 {
+					r.fail("dbx: %v expects non-empty objects, got %T", key, item)
+					continue
+				}
+				if expr := r.filter(obj); expr != "" {
+					subs = append(subs, expr)
+				}
+			}
+			if len(subs) > 0 {
+				parts = append(parts, "("+strings.Join(subs, gox.IfElse(key == "$or", " OR ", " AND ").(string))+")")
+			}
+			continue
+		}
+		col := r.ident(key)
+		if obj, ok := asObj(val); ok && isOpObj(obj) {
+			opKeys := obj.Keys()
+			sort.Strings(opKeys)
+			for _, op := range opKeys {
+				parts = append(parts, r.cond(col, op, plainVal(obj[op])))
+			}
+			continue
+		}
+		parts = append(parts, r.cond(col, "$eq", val))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+var compareOps = map[string]string{"$eq": "=", "$ne": "<>", "$gt": ">", "$gte": ">=", "$lt": "<", "$lte": "<=", "$like": "LIKE"}
+
+func (r *render) cond(col, op string, val any) string {
+	if op == "$null" {
+		return col + gox.IfElse(truthy(val), " IS NULL", " IS NOT NULL").(string)
+	}
+	if list := asList(val); list != nil && (op == "$eq" || op == "$in" || op == "$ne" || op == "$nin") {
+		not := op == "$ne" || op == "$nin"
+		if len(list) == 0 {
+			return gox.IfElse(not, "1 = 1", "1 = 0").(string)
+		}
+		holders := make([]string, len(list))
+		for i, item := range list {
+			holders[i] = r.arg(item)
+		}
+		return col + gox.IfElse(not, " NOT IN (", " IN (").(string) + strings.Join(holders, ", ") + ")"
+	}
+	if val == nil && (op == "$eq" || op == "$ne") {
+		return col + gox.IfElse(op == "$eq", " IS NULL", " IS NOT NULL").(string)
+	}
+	sqlOp, ok := compareOps[op]
+	if !ok {
+		r.fail("dbx: unsupported operator %v on %v", op, col)
+		return "1 = 0"
+	}
+	return col + " " + sqlOp + " " + r.arg(val)
+}
+
+func (r *render) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+}
+
+// plainVal 将jsonx值还原为驱动可识别的go值
+func plainVal(v any) any {
+	if jv, ok := v.(jsonx.JValue); ok {
+		return jv.ToGVal()
+	}
+	return v
+}
+
+func asObj(v any) (jsonx.JObj, bool) {
+	switch obj := v.(type) {
+	case jsonx.JObj:
+		return obj, true
+	case *jsonx.JObj:
+		return *obj, obj != nil
+	case map[string]any:
+		return obj, true
+	}
+	return nil, false
+}
+
+// asList 切片(除[]byte)转为[]any，非切片返回nil
+func asList(v any) []any {
+	if v == nil {
+		return nil
+	}
+	if _, ok := v.([]byte); ok {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = plainVal(rv.Index(i).Interface())
+	}
+	return list
+}
+
+func isOpObj(obj jsonx.JObj) bool {
+	for key := range obj {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(obj) > 0
+}
+
+func truthy(v any) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case nil:
+		return false
+	default:
+		f, err := toFloat(reflect.ValueOf(v))
+		return err == nil && f != 0
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilderSelect(t *testing.T) {
+	b := Select("users", "id", "name", "count(*) AS n").
+		Where(jsonx.JObj{"age": jsonx.JObj{"$gte": 18, "$lt": 60}, "tag": []any{"a", "b"}, "deleted_at": nil}).
+		WhereRaw("name LIKE ?", "t%").
+		GroupBy("id", "name").OrderBy("-age", "name").Limit(10).Offset(20)
+
+	query, args, err := b.Build(DialectPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "id", "name", count(*) AS n FROM "users" WHERE "age" >= $1 AND "age" < $2 AND "deleted_at" IS NULL AND "tag" IN ($3, $4) AND (name LIKE $5) GROUP BY "id", "name" ORDER BY "age" DESC, "name" ASC LIMIT 10 OFFSET 20`, query)
+	assert.Equal(t, []any{18, 60, "a", "b", "t%"}, args)
+
+	query, _, err = b.Build(DialectMySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `id`, `name`, count(*) AS n FROM `users` WHERE `age` >= ? AND `age` < ? AND `deleted_at` IS NULL AND `tag` IN (?, ?) AND (name LIKE ?) GROUP BY `id`, `name` ORDER BY `age` DESC, `name` ASC LIMIT 10 OFFSET 20", query)
+}
+
+func TestBuilderFilterFromJson(t *testing.T) {
+	filter := jsonx.ParseJObj(`{"$or":[{"name":"a"},{"score":{"$gt":1.5}}],"id":{"$nin":[]}}`)
+	query, args, err := Select("t").Where(filter).Build(DialectPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "t" WHERE ("name" = $1 OR "score" > $2) AND 1 = 1`, query)
+	assert.Equal(t, []any{"a", 1.5}, args)
+
+	_, _, err = Select("t").Where(jsonx.JObj{"a; drop table t": 1}).Build(DialectPostgres)
+	assert.Error(t, err)
+	_, _, err = Select("t").Where(jsonx.JObj{"a": jsonx.JObj{"$regex": 1}}).Build(DialectPostgres)
+	assert.Error(t, err)
+	_, _, err = Select("t").OrderBy("-a desc").Build(DialectPostgres)
+	assert.Error(t, err)
+
+	// $or/$and不是非空对象列表时报错，而不是忽略条件返回全表
+	for _, bad := range []string{
+		`{"$or":{"name":"a"}}`, `{"$or":"x"}`, `{"$and":null}`,
+		`{"$or":[]}`, `{"$and":[]}`, `{"$or":[{}]}`, `{"$or":["name"]}`,
+	} {
+		_, _, err = Select("t").Where(jsonx.ParseJObj(bad)).Build(DialectPostgres)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestBuilderWrite(t *testing.T) {
+	query, args, err := Insert("t", "id", "name").Values(1, "a").Values(2, "b").Build(DialectPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "t" ("id", "name") VALUES ($1, $2), ($3, $4)`, query)
+	assert.Equal(t, []any{1, "a", 2, "b"}, args)
+
+	query, args, err = Update("t").SetObj(jsonx.JObj{"name": "x"}).Where(jsonx.JObj{"id": 1}).Build(DialectMySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE `t` SET `name` = ? WHERE `id` = ?", query)
+	assert.Equal(t, []any{"x", 1}, args)
+
+	_, _, err = Delete("t").Build(DialectMySQL)
+	assert.Error(t, err)
+	query, _, err = Delete("t").WhereRaw("1=1").Build(DialectMySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM `t` WHERE (1=1)", query)
+}
+
+func TestBuilderUpsert(t *testing.T) {
+	b := Upsert("t", "id").Rows(jsonx.JObj{"id": 1, "name": "a", "age": 2})
+	query, _, err := b.Build(DialectPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "t" ("age", "id", "name") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "age" = EXCLUDED."age", "name" = EXCLUDED."name"`, query)
+	query, _, err = b.Build(DialectMySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `t` (`age`, `id`, `name`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `age` = VALUES(`age`), `name` = VALUES(`name`)", query)
+	query, _, err = b.Build(DialectDoris)
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `t` (`age`, `id`, `name`) VALUES (?, ?, ?)", query)
+	query, _, err = Upsert("t", "id").Rows(jsonx.JObj{"id": 1}).DoNothing().Build(DialectPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "t" ("id") VALUES ($1) ON CONFLICT ("id") DO NOTHING`, query)
+}
+
+func TestBuilderExec(t *testing.T) {
+	db := &fakeQuery{d: DialectMySQL}
+	_, err := Update("t").Set("a", jsonx.NewJInt(1)).Where(jsonx.JObj{"id": jsonx.NewJStr("x")}).Exec(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE `t` SET `a` = ? WHERE `id` = ?", db.execs[0])
+	assert.Equal(t, []any{int64(1), "x"}, db.args[0])
+}
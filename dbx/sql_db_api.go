@@ -5,31 +5,93 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fengzhi09/golibx/gox"
 	"github.com/fengzhi09/golibx/jsonx"
 	"github.com/fengzhi09/golibx/logx"
 
+	"gorm.io/gorm"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// ExecResult 写操作结果
+type ExecResult struct {
+	RowsAffected int64 // 影响行数
+	LastInsertId int64 // 自增主键(PostgreSQL不支持，请使用RETURNING)
+}
+
+// IQuery 查询接口，数据库实例与事务均实现该接口
+type IQuery interface {
+	// Query 执行查询
+	Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error)
+	// QueryEach 流式查询，逐行回调fn；fn返回ErrStopEach时提前结束且不视为错误
+	QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error
+	// Exec 执行写操作
+	Exec(ctx context.Context, query string, args ...any) (ExecResult, error)
+	// Dialect SQL方言
+	Dialect() Dialect
+}
+
+// ITx 事务接口
+type ITx interface {
+	IQuery
+	// Commit 提交事务
+	Commit(ctx context.Context) error
+	// Rollback 回滚事务
+	Rollback(ctx context.Context) error
+}
+
 // ISQL 数据库接口
 type ISQL interface {
+	IQuery
+	ISchema
 	// Connect 建立数据库连接
 	Connect(ctx context.Context) error
-	// Query 执行查询
-	Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error)
+	// Begin 开启事务
+	Begin(ctx context.Context) (ITx, error)
+	// BulkInsert 批量写入，返回写入行数
+	BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error)
 	// Close 关闭数据库连接
 	Close(ctx context.Context) error
 }
 
 type DBConf = *jsonx.JObj
 
+// WithTx 在事务中执行fn，fn返回错误或panic时回滚，否则提交
+func WithTx(ctx context.Context, db ISQL, fn func(tx ITx) error) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback(ctx)
+			panic(r)
+		}
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+	return fn(tx)
+}
+
 // getOrDefault 获取配置字符串
 func getOrDefault(conf *jsonx.JObj, key, defaultValue string) string {
 	return gox.IfElse(conf.Contains(key), conf.GetStr(key), defaultValue).(string)
 }
 
+// getIntOr 获取配置整数
+func getIntOr(conf *jsonx.JObj, key string, defaultValue int) int {
+	if conf == nil || !conf.Contains(key) {
+		return defaultValue
+	}
+	return conf.GetInt(key)
+}
+
 func getInOrder(conf *jsonx.JObj, keys ...string) string {
 	for _, key := range keys {
 		if val := conf.GetStr(key); val != "" {
@@ -68,8 +130,14 @@ func NewDoris(name string, conf DBConf) ISQL {
 
 // DBMgr 数据库管理器
 type DBMgr struct {
-	dbMap map[string]ISQL
-	mutex sync.RWMutex
+	dbMap   map[string]ISQL
+	confMap map[string]DBConf
+	hooks   []Hook
+	// listeners Listen创建的监听器，CloseAll时关闭
+	listeners []*PgListener
+	// gormMap Gorm按名称缓存的gorm实例
+	gormMap map[string]*gorm.DB
+	mutex   sync.RWMutex
 }
 
 var (
@@ -81,7 +149,8 @@ var (
 func DB() *DBMgr {
 	dbMgrOnce.Do(func() {
 		dbMgrInstance = &DBMgr{
-			dbMap: make(map[string]ISQL),
+			dbMap:   make(map[string]ISQL),
+			confMap: make(map[string]DBConf),
 		}
 	})
 	return dbMgrInstance
@@ -93,23 +162,12 @@ func (dm *DBMgr) Init(ctx context.Context, dbs map[string]DBConf) error {
 	defer dm.mutex.Unlock()
 
 	for name, conf := range dbs {
-		// 从配置中获取URL或单独的连接参数
-		dbType, err := dm.detectDBType(conf)
+		db, err := dm.newSQL(name, conf)
 		if err != nil {
-			return fmt.Errorf("failed to detect DB type for %s: %v", name, err)
+			return err
 		}
-
-		var db ISQL
-
-		switch dbType {
-		case "postgresql", "postgres":
-			db = NewPSQL(name, conf)
-		case "mysql":
-			db = NewMSQL(name, conf)
-		case "doris":
-			db = NewDoris(name, conf)
-		default:
-			return fmt.Errorf("unsupported database type: %s", dbType)
+		if hooks := dm.hooksOf(conf); len(hooks) > 0 {
+			db = WithHooks(name, db, hooks...)
 		}
 
 		// 建立连接
@@ -118,11 +176,75 @@ func (dm *DBMgr) Init(ctx context.Context, dbs map[string]DBConf) error {
 		}
 
 		dm.dbMap[name] = db
+		dm.confMap[name] = conf
 	}
 
 	return nil
 }
 
+// AddHooks 注册拦截器，作用于之后Init的数据库
+func (dm *DBMgr) AddHooks(hooks ...Hook) {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	dm.hooks = append(dm.hooks, hooks...)
+}
+
+// hooksOf 注册的拦截器，加上配置metrics(写入DefaultMetrics)与slow_ms(慢查询日志)对应的内置拦截器
+func (dm *DBMgr) hooksOf(conf DBConf) []Hook {
+	hooks := append([]Hook{}, dm.hooks...)
+	if conf.GetBool("metrics") {
+		hooks = append(hooks, DefaultMetrics)
+	}
+	if ms := getIntOr(conf, "slow_ms", 0); ms > 0 {
+		hooks = append(hooks, SlowLog(time.Duration(ms)*time.Millisecond))
+	}
+	return hooks
+}
+
+// newSQL 按配置创建数据库实例；配置了replicas时创建读写分离实例
+func (dm *DBMgr) newSQL(name string, conf DBConf) (ISQL, error) {
+	if conf.Contains("replicas") {
+		primary, err := dm.newSQL(name, routeConf(conf, conf.GetObj("primary")))
+		if err != nil {
+			return nil, err
+		}
+		replicas := make([]ISQL, 0)
+		for i, section := range conf.GetObjArr("replicas") {
+			db, err := dm.newSQL(fmt.Sprintf("%s[%d]", name, i), routeConf(conf, section))
+			if err != nil {
+				return nil, err
+			}
+			replicas = append(replicas, db)
+		}
+		return NewRouteSQL(name, conf, primary, replicas...), nil
+	}
+
+	// 从配置中获取URL或单独的连接参数
+	dbType, err := dm.detectDBType(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect DB type for %s: %v", name, err)
+	}
+
+	var db ISQL
+	switch dbType {
+	case "postgresql", "postgres":
+		db = NewPSQL(name, conf)
+	case "mysql":
+		db = NewMSQL(name, conf)
+	case "doris":
+		db = NewDoris(name, conf)
+	case "sqlite", "sqlite3":
+		db = NewSQLite(name, conf)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	// 配置resilient=true时启用重试与熔断
+	if !conf.GetBool("resilient") {
+		return db, nil
+	}
+	return WithResilience(name, db, conf), nil
+}
+
 // GetDB 获取数据库实例
 func (dm *DBMgr) Use(name string) (ISQL, error) {
 	dm.mutex.RLock()
@@ -141,14 +263,28 @@ func (dm *DBMgr) CloseAll(ctx context.Context) {
 	dm.mutex.Lock()
 	defer dm.mutex.Unlock()
 
-	for _, db := range dm.dbMap {
+	for name, db := range dm.dbMap {
 		if err := db.Close(ctx); err != nil {
 			// 错误处理
-			logx.Warnf(ctx, "关闭数据库 %s 连接失败: %v", db.(*PSql).name, err)
+			logx.Warnf(ctx, "关闭数据库 %s 连接失败: %v", name, err)
+		}
+	}
+
+	for name, g := range dm.gormMap {
+		if err := closeGorm(g); err != nil {
+			logx.Warnf(ctx, "关闭数据库 %s gorm连接失败: %v", name, err)
+		}
+	}
+	for _, l := range dm.listeners {
+		if err := l.Close(ctx); err != nil {
+			logx.Warnf(ctx, "关闭数据库 %s 监听失败: %v", l.name, err)
 		}
 	}
 
 	dm.dbMap = make(map[string]ISQL)
+	dm.confMap = make(map[string]DBConf)
+	dm.listeners = nil
+	dm.gormMap = nil
 }
 
 // detectDBType 检测数据库类型
@@ -168,6 +304,8 @@ func (dm *DBMgr) detectDBType(conf DBConf) (string, error) {
 			return "mysql", nil
 		} else if strings.HasPrefix(strings.ToLower(url), "doris://") {
 			return "doris", nil
+		} else if strings.HasPrefix(strings.ToLower(url), "sqlite://") {
+			return "sqlite", nil
 		}
 	}
 
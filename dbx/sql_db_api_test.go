@@ -0,0 +1,83 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	db := NewSQLite("tx", &jsonx.JObj{"db_url": "sqlite://:memory:"})
+	assert.NoError(t, db.Connect(ctx))
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+	assert.NoError(t, err)
+	count := func() int64 {
+		rows, err := db.Query(ctx, "SELECT COUNT(*) AS n FROM t")
+		assert.NoError(t, err)
+		return rows[0].GetLong("n")
+	}
+
+	// 提交
+	err = WithTx(ctx, db, func(tx ITx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO t VALUES (1)")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count())
+
+	// 返回错误时回滚
+	errBiz := errors.New("biz")
+	err = WithTx(ctx, db, func(tx ITx) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (2)"); err != nil {
+			return err
+		}
+		return errBiz
+	})
+	assert.ErrorIs(t, err, errBiz)
+	assert.Equal(t, int64(1), count())
+
+	// panic时回滚并继续抛出
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = WithTx(ctx, db, func(tx ITx) error {
+			if _, err := tx.Exec(ctx, "INSERT INTO t VALUES (3)"); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+	assert.Equal(t, int64(1), count())
+}
+
+func TestPoolConfig(t *testing.T) {
+	conf := &jsonx.JObj{"host": "db", "pool_size": 20, "pool_min_idle": 2, "pool_idle_sec": 30, "pool_life_sec": 600}
+	cfg, err := (&PSql{}).PoolConfig(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), cfg.MaxConns)
+	assert.Equal(t, int32(2), cfg.MinConns)
+	assert.Equal(t, 30*time.Second, cfg.MaxConnIdleTime)
+	assert.Equal(t, 600*time.Second, cfg.MaxConnLifetime)
+	assert.Equal(t, "db", cfg.ConnConfig.Host)
+
+	// 未配置时保留pgxpool默认值
+	cfg, err = (&PSql{}).PoolConfig(&jsonx.JObj{})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, cfg.MaxConnLifetime)
+
+	_, err = (&PSql{}).PoolConfig(&jsonx.JObj{"db_url": "postgres://%zz"})
+	assert.Error(t, err)
+
+	// sql.Open不建立连接，可直接检查连接池设置
+	db, err := sql.Open("mysql", (&MSql{}).ConnString(conf))
+	assert.NoError(t, err)
+	defer db.Close()
+	tunePool(db, conf)
+	assert.Equal(t, 20, db.Stats().MaxOpenConnections)
+}
@@ -0,0 +1,277 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ConflictPolicy 批量写入遇到主键/唯一键冲突时的处理策略
+type ConflictPolicy int
+
+const (
+	// ConflictError 冲突即报错(默认)
+	ConflictError ConflictPolicy = iota
+	// ConflictIgnore 忽略冲突行
+	ConflictIgnore
+	// ConflictUpdate 以新值覆盖冲突行；同一批内冲突键重复时以最后一行为准，返回的行数按输入行计
+	ConflictUpdate
+)
+
+// BulkConf 批量写入配置
+type BulkConf struct {
+	BatchSize int                   // 每批行数，默认1000
+	Conflict  ConflictPolicy        // 冲突策略
+	Keys      []string              // 冲突键，PostgreSQL在Ignore/Update策略下必填
+	Progress  func(done, total int) // 每批完成后回调
+	Client    *http.Client          // Doris Stream Load使用的http客户端
+}
+
+// BulkOpt 批量写入选项
+type BulkOpt func(conf *BulkConf)
+
+// WithBatchSize 设置每批行数
+func WithBatchSize(size int) BulkOpt {
+	return func(conf *BulkConf) { conf.BatchSize = size }
+}
+
+// WithConflict 设置冲突策略与冲突键
+func WithConflict(policy ConflictPolicy, keys ...string) BulkOpt {
+	return func(conf *BulkConf) { conf.Conflict, conf.Keys = policy, keys }
+}
+
+// WithProgress 设置进度回调
+func WithProgress(progress func(done, total int)) BulkOpt {
+	return func(conf *BulkConf) { conf.Progress = progress }
+}
+
+// WithHttpClient 设置Doris Stream Load的http客户端
+func WithHttpClient(client *http.Client) BulkOpt {
+	return func(conf *BulkConf) { conf.Client = client }
+}
+
+func newBulkConf(opts []BulkOpt) *BulkConf {
+	conf := &BulkConf{BatchSize: 1000}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+	return conf
+}
+
+// BulkRows 将JObj行(如excelx解析结果)按columns顺序转为批量写入的行
+func BulkRows(columns []string, objs ...*jsonx.JObj) [][]any {
+	rows := make([][]any, 0, len(objs))
+	for _, obj := range objs {
+		row := make([]any, len(columns))
+		for i, col := range columns {
+			row[i] = plainVal((*obj)[col])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// eachBatch 按批次切分rows并回调，批次完成后上报进度
+func (bc *BulkConf) eachBatch(rows [][]any, fn func(batch [][]any) (int64, error)) (int64, error) {
+	total := int64(0)
+	for start := 0; start < len(rows); start += bc.BatchSize {
+		end := min(start+bc.BatchSize, len(rows))
+		n, err := fn(rows[start:end])
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if bc.Progress != nil {
+			bc.Progress(end, len(rows))
+		}
+	}
+	return total, nil
+}
+
+// checkBulk 校验表名与列名
+func checkBulk(table string, columns []string) error {
+	if !IsIdent(table) {
+		return fmt.Errorf("dbx: bad table name %q", table)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("dbx: bulk insert into %v without columns", table)
+	}
+	for _, col := range columns {
+		if !IsIdent(col) {
+			return fmt.Errorf("dbx: bad column name %q", col)
+		}
+	}
+	return nil
+}
+
+// conflictClause 渲染冲突子句
+func conflictClause(d Dialect, table string, columns, keys []string, doNothing bool) (string, error) {
+	r := &render{d: d}
+	b := &Builder{op: opUpsert, table: table, columns: columns, keys: keys, doNothing: doNothing}
+	b.buildConflict(r)
+	return r.sb.String(), r.err
+}
+
+// sqlBulkInsert 以多行INSERT分批写入(MySQL/SQLite)
+func sqlBulkInsert(ctx context.Context, db IQuery, table string, columns []string, rows [][]any, conf *BulkConf) (int64, error) {
+	// 单条语句的占位符上限: MySQL 65535，SQLite 32766
+	maxVars := gox.IfElse(db.Dialect() == DialectSQLite, 32766, 65535).(int)
+	if maxRows := maxVars / len(columns); conf.BatchSize > maxRows {
+		capped := *conf
+		capped.BatchSize = maxRows
+		conf = &capped
+	}
+	return conf.eachBatch(rows, func(batch [][]any) (int64, error) {
+		var b *Builder
+		switch conf.Conflict {
+		case ConflictIgnore:
+			b = Upsert(table, conf.Keys...).DoNothing()
+		case ConflictUpdate:
+			b = Upsert(table, conf.Keys...)
+		default:
+			b = Insert(table)
+		}
+		b.Columns(columns...)
+		for _, row := range batch {
+			b.Values(row...)
+		}
+		res, err := b.Exec(ctx, db)
+		// MySQL的ON DUPLICATE KEY UPDATE每更新一行计2、值未变计0，按输入行数返回
+		if err == nil && conf.Conflict == ConflictUpdate && db.Dialect() == DialectMySQL {
+			return int64(len(batch)), nil
+		}
+		return res.RowsAffected, err
+	})
+}
+
+// dedupeRows 按冲突键去重，保留最后出现的行；PostgreSQL的ON CONFLICT DO UPDATE不允许同一语句两次更新同一行
+func dedupeRows(batch [][]any, columns, keys []string) [][]any {
+	idx := make([]int, 0, len(keys))
+	for _, key := range keys {
+		for i, col := range columns {
+			if col == key {
+				idx = append(idx, i)
+			}
+		}
+	}
+	if len(idx) == 0 {
+		return batch
+	}
+	last := make(map[string]int, len(batch))
+	keyOf := make([]string, len(batch))
+	for i, row := range batch {
+		vals := make([]any, len(idx))
+		for j, k := range idx {
+			vals[j] = row[k]
+		}
+		keyOf[i] = fmt.Sprintf("%#v", vals)
+		last[keyOf[i]] = i
+	}
+	if len(last) == len(batch) {
+		return batch
+	}
+	out := make([][]any, 0, len(last))
+	for i, row := range batch {
+		if last[keyOf[i]] == i {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+// streamLoad 通过Doris Stream Load(HTTP)分批写入
+func (m *MSql) streamLoad(ctx context.Context, table string, columns []string, rows [][]any, conf *BulkConf) (int64, error) {
+	if conf.Conflict == ConflictIgnore {
+		return 0, fmt.Errorf("dbx: doris stream load does not support conflict ignore")
+	}
+	dsn, err := mysql.ParseDSN(m.ConnString(m.conf))
+	if err != nil {
+		return 0, fmt.Errorf("%v parse dsn error: %v", m.dbType, err)
+	}
+	dbName := getOrDefault(m.conf, "dbname", dsn.DBName)
+	baseURL := getOrDefault(m.conf, "stream_load_url", "")
+	if baseURL == "" {
+		host, _, _ := net.SplitHostPort(dsn.Addr)
+		baseURL = fmt.Sprintf("http://%v:%v", host, getOrDefault(m.conf, "http_port", "8030"))
+	}
+	loadURL := fmt.Sprintf("%v/api/%v/%v/_stream_load", strings.TrimSuffix(baseURL, "/"), dbName, table)
+	client := conf.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	// FE会307重定向到BE，重定向时需重新携带认证
+	authed := *client
+	authed.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		req.SetBasicAuth(dsn.User, dsn.Passwd)
+		return nil
+	}
+	return conf.eachBatch(rows, func(batch [][]any) (int64, error) {
+		body, err := streamLoadBody(columns, batch)
+		if err != nil {
+			return 0, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, loadURL, bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		req.SetBasicAuth(dsn.User, dsn.Passwd)
+		req.Header.Set("Expect", "100-continue")
+		req.Header.Set("format", "json")
+		req.Header.Set("strip_outer_array", "true")
+		req.Header.Set("columns", strings.Join(columns, ","))
+		req.Header.Set("label", fmt.Sprintf("dbx_%v_%v", table, NewOID().Hex()))
+		resp, err := authed.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("%v stream load error: %v", m.dbType, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		result := jsonx.JObj{}
+		if err := jsonx.Unmarshal(data, &result); err != nil {
+			return 0, fmt.Errorf("%v stream load bad response(%v): %s", m.dbType, resp.StatusCode, data)
+		}
+		if status := result.GetStr("Status"); status != "Success" && status != "Publish Timeout" {
+			return 0, fmt.Errorf("%v stream load %v: %v %v", m.dbType, status, result.GetStr("Message"), result.GetStr("ErrorURL"))
+		}
+		return result.GetLong("NumberLoadedRows"), nil
+	})
+}
+
+// streamLoadBody 将行编码为json数组
+func streamLoadBody(columns []string, rows [][]any) ([]byte, error) {
+	objs := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("dbx: bulk row %d has %d values, want %d", i, len(row), len(columns))
+		}
+		obj := make(map[string]any, len(columns))
+		for j, col := range columns {
+			switch v := row[j].(type) {
+			case time.Time:
+				obj[col] = v.Format(time.DateTime)
+			case []byte:
+				obj[col] = string(v)
+			default:
+				obj[col] = plainVal(v)
+			}
+		}
+		objs[i] = obj
+	}
+	return jsonx.Marshal(objs)
+}
@@ -0,0 +1,358 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+)
+
+// QueryEvent 一次数据库调用的上下文，Before时Duration/Rows/Err尚未填充
+type QueryEvent struct {
+	DB       string        // DBConf名
+	Op       string        // query/exec/begin/commit/rollback/bulk
+	SQL      string        // 语句，bulk时为目标表
+	Args     []any         // 参数，bulk时为空
+	TraceID  string        // 上下文中的trace/request id
+	InTx     bool          // 是否在事务中
+	Start    time.Time     // 开始时间
+	Duration time.Duration // 耗时
+	Rows     int64         // 返回或影响的行数
+	Err      error         // 错误
+}
+
+// Hook 拦截器：Before可返回派生的ctx(如开启span)，After按注册的逆序调用
+type Hook interface {
+	Before(ctx context.Context, ev *QueryEvent) context.Context
+	After(ctx context.Context, ev *QueryEvent)
+}
+
+// AfterHook 只关心调用结果的拦截器
+type AfterHook func(ctx context.Context, ev *QueryEvent)
+
+// Before 不做处理
+func (f AfterHook) Before(ctx context.Context, ev *QueryEvent) context.Context { return ctx }
+
+// After 调用f
+func (f AfterHook) After(ctx context.Context, ev *QueryEvent) { f(ctx, ev) }
+
+type traceKey struct{}
+
+// WithTraceID 在上下文中设置trace id
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceID)
+}
+
+// traceKeys 兼容以字符串为键存放的trace/request id(如gin.Context.Set)
+var traceKeys = []string{"trace_id", "traceId", "request_id", "requestId", "X-Request-Id"}
+
+// TraceIDOf 读取上下文中的trace/request id
+func TraceIDOf(ctx context.Context) string {
+	if id, ok := ctx.Value(traceKey{}).(string); ok {
+		return id
+	}
+	for _, key := range traceKeys {
+		if id, ok := ctx.Value(key).(string); ok && id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// HookSQL 为ISQL挂载拦截器链，事务内的调用同样经过拦截器
+type HookSQL struct {
+	name  string
+	db    ISQL
+	hooks []Hook
+}
+
+// WithHooks 为db挂载拦截器；db已挂载时追加到原有链
+func WithHooks(name string, db ISQL, hooks ...Hook) *HookSQL {
+	if h, ok := db.(*HookSQL); ok {
+		return &HookSQL{name: h.name, db: h.db, hooks: append(append([]Hook{}, h.hooks...), hooks...)}
+	}
+	return &HookSQL{name: name, db: db, hooks: hooks}
+}
+
+// Unwrap 被装饰的ISQL
+func (h *HookSQL) Unwrap() ISQL {
+	return h.db
+}
+
+// Unwrap 逐层剥离装饰器(拦截器等)，返回底层的ISQL
+func Unwrap(db ISQL) ISQL {
+	for {
+		w, ok := db.(interface{ Unwrap() ISQL })
+		if !ok {
+			return db
+		}
+		db = w.Unwrap()
+	}
+}
+
+// intercept 依次调用Before、fn与逆序的After
+func intercept(ctx context.Context, hooks []Hook, ev *QueryEvent, fn func(ctx context.Context) (int64, error)) error {
+	ev.TraceID = TraceIDOf(ctx)
+	ev.Start = time.Now()
+	for _, hook := range hooks {
+		ctx = hook.Before(ctx, ev)
+	}
+	ev.Rows, ev.Err = fn(ctx)
+	ev.Duration = time.Since(ev.Start)
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].After(ctx, ev)
+	}
+	return ev.Err
+}
+
+// hookQuery IQuery的拦截实现，连接与事务共用
+type hookQuery struct {
+	name  string
+	q     IQuery
+	hooks []Hook
+	inTx  bool
+}
+
+func (h *hookQuery) event(op, query string, args []any) *QueryEvent {
+	return &QueryEvent{DB: h.name, Op: op, SQL: query, Args: args, InTx: h.inTx}
+}
+
+func (h *hookQuery) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	var rows []*jsonx.JObj
+	err := intercept(ctx, h.hooks, h.event("query", query, args), func(ctx context.Context) (int64, error) {
+		var err error
+		rows, err = h.q.Query(ctx, query, args...)
+		return int64(len(rows)), err
+	})
+	return rows, err
+}
+
+func (h *hookQuery) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	return intercept(ctx, h.hooks, h.event("query", query, args), func(ctx context.Context) (int64, error) {
+		n := int64(0)
+		err := h.q.QueryEach(ctx, query, args, func(row *jsonx.JObj) error {
+			n++
+			return fn(row)
+		})
+		return n, err
+	})
+}
+
+func (h *hookQuery) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	var res ExecResult
+	err := intercept(ctx, h.hooks, h.event("exec", query, args), func(ctx context.Context) (int64, error) {
+		var err error
+		res, err = h.q.Exec(ctx, query, args...)
+		return res.RowsAffected, err
+	})
+	return res, err
+}
+
+func (h *hookQuery) Dialect() Dialect {
+	return h.q.Dialect()
+}
+
+func (h *HookSQL) iq() *hookQuery {
+	return &hookQuery{name: h.name, q: h.db, hooks: h.hooks}
+}
+
+// Query 经拦截器执行查询
+func (h *HookSQL) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	return h.iq().Query(ctx, query, args...)
+}
+
+// QueryEach 经拦截器流式查询，Rows为实际回调的行数
+func (h *HookSQL) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	return h.iq().QueryEach(ctx, query, args, fn)
+}
+
+// Exec 经拦截器执行写操作
+func (h *HookSQL) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	return h.iq().Exec(ctx, query, args...)
+}
+
+// Dialect 底层方言
+func (h *HookSQL) Dialect() Dialect {
+	return h.db.Dialect()
+}
+
+// Connect 建立连接
+func (h *HookSQL) Connect(ctx context.Context) error {
+	return h.db.Connect(ctx)
+}
+
+// Begin 经拦截器开启事务，返回的事务同样经过拦截器
+func (h *HookSQL) Begin(ctx context.Context) (ITx, error) {
+	var tx ITx
+	err := intercept(ctx, h.hooks, &QueryEvent{DB: h.name, Op: "begin"}, func(ctx context.Context) (int64, error) {
+		var err error
+		tx, err = h.db.Begin(ctx)
+		return 0, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &hookTx{hookQuery: hookQuery{name: h.name, q: tx, hooks: h.hooks, inTx: true}, tx: tx}, nil
+}
+
+// BulkInsert 经拦截器批量写入
+func (h *HookSQL) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	var n int64
+	err := intercept(ctx, h.hooks, &QueryEvent{DB: h.name, Op: "bulk", SQL: table}, func(ctx context.Context) (int64, error) {
+		var err error
+		n, err = h.db.BulkInsert(ctx, table, columns, rows, opts...)
+		return n, err
+	})
+	return n, err
+}
+
+// Tables 经拦截器查询表与视图
+func (h *HookSQL) Tables(ctx context.Context) ([]Table, error) {
+	return schemaTables(ctx, h)
+}
+
+// Columns 表的列
+func (h *HookSQL) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, h, table)
+}
+
+// Indexes 表的索引
+func (h *HookSQL) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, h, table)
+}
+
+// PrimaryKey 表的主键列
+func (h *HookSQL) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, h, table)
+}
+
+// withLock 使用底层的会话锁
+func (h *HookSQL) withLock(ctx context.Context, key string, fn func() error) error {
+	return withDBLock(ctx, h.db, key, fn)
+}
+
+// Close 关闭连接
+func (h *HookSQL) Close(ctx context.Context) error {
+	return h.db.Close(ctx)
+}
+
+// hookTx 经拦截器的事务
+type hookTx struct {
+	hookQuery
+	tx ITx
+}
+
+// Commit 经拦截器提交事务
+func (t *hookTx) Commit(ctx context.Context) error {
+	return intercept(ctx, t.hooks, t.event("commit", "", nil), func(ctx context.Context) (int64, error) {
+		return 0, t.tx.Commit(ctx)
+	})
+}
+
+// Rollback 经拦截器回滚事务
+func (t *hookTx) Rollback(ctx context.Context) error {
+	return intercept(ctx, t.hooks, t.event("rollback", "", nil), func(ctx context.Context) (int64, error) {
+		return 0, t.tx.Rollback(ctx)
+	})
+}
+
+// SlowLog 耗时不低于threshold的调用通过logx.WarnfM记录
+func SlowLog(threshold time.Duration) Hook {
+	return AfterHook(func(ctx context.Context, ev *QueryEvent) {
+		if ev.Duration < threshold {
+			return
+		}
+		logx.WarnfM(ctx, "dbx", "慢查询 db=%s op=%s cost=%v rows=%d trace=%s err=%v sql=%s args=%v",
+			ev.DB, ev.Op, ev.Duration, ev.Rows, ev.TraceID, ev.Err, ev.SQL, ev.Args)
+	})
+}
+
+// LatencyBuckets 耗时直方图的桶上界，超出最后一个上界的计入溢出桶
+var LatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// DBMetrics 单个数据库的调用统计
+type DBMetrics struct {
+	Count   int64
+	Errors  int64
+	Total   time.Duration
+	Max     time.Duration
+	Buckets []int64 // 与LatencyBuckets对应，多出的最后一个为溢出桶
+}
+
+// Avg 平均耗时
+func (m DBMetrics) Avg() time.Duration {
+	if m.Count == 0 {
+		return 0
+	}
+	return m.Total / time.Duration(m.Count)
+}
+
+// String 统计摘要
+func (m DBMetrics) String() string {
+	return fmt.Sprintf("count=%d errors=%d avg=%v max=%v buckets=%v", m.Count, m.Errors, m.Avg(), m.Max, m.Buckets)
+}
+
+// Metrics 按DBConf名统计耗时直方图与错误数的拦截器(内存)
+type Metrics struct {
+	mutex sync.Mutex
+	dbs   map[string]*DBMetrics
+}
+
+// DefaultMetrics DBMgr配置metrics时使用的统计
+var DefaultMetrics = NewMetrics()
+
+// NewMetrics 创建统计拦截器
+func NewMetrics() *Metrics {
+	return &Metrics{dbs: make(map[string]*DBMetrics)}
+}
+
+// Before 不做处理
+func (m *Metrics) Before(ctx context.Context, ev *QueryEvent) context.Context { return ctx }
+
+// After 累计耗时与错误
+func (m *Metrics) After(ctx context.Context, ev *QueryEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stat, ok := m.dbs[ev.DB]
+	if !ok {
+		stat = &DBMetrics{Buckets: make([]int64, len(LatencyBuckets)+1)}
+		m.dbs[ev.DB] = stat
+	}
+	stat.Count++
+	stat.Total += ev.Duration
+	stat.Max = max(stat.Max, ev.Duration)
+	if ev.Err != nil {
+		stat.Errors++
+	}
+	i := 0
+	for i < len(LatencyBuckets) && ev.Duration > LatencyBuckets[i] {
+		i++
+	}
+	stat.Buckets[i]++
+}
+
+// Snapshot 当前统计的副本
+func (m *Metrics) Snapshot() map[string]DBMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	snap := make(map[string]DBMetrics, len(m.dbs))
+	for name, stat := range m.dbs {
+		cp := *stat
+		cp.Buckets = append([]int64{}, stat.Buckets...)
+		snap[name] = cp
+	}
+	return snap
+}
+
+// Reset 清空统计
+func (m *Metrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.dbs = make(map[string]*DBMetrics)
+}
@@ -0,0 +1,75 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookSQL(t *testing.T) {
+	var events []QueryEvent
+	record := AfterHook(func(ctx context.Context, ev *QueryEvent) { events = append(events, *ev) })
+	metrics := NewMetrics()
+	base := &fakeSQL{fakeQuery: &fakeQuery{rows: []*jsonx.JObj{{"id": 1}, {"id": 2}}}}
+	db := WithHooks("main", base, record, metrics)
+
+	ctx := context.WithValue(context.Background(), "request_id", "req-1")
+	_, err := db.Query(ctx, "SELECT * FROM users WHERE id > ?", 0)
+	assert.NoError(t, err)
+	err = WithTx(ctx, db, func(tx ITx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET name = ?", "tom")
+		return err
+	})
+	assert.NoError(t, err)
+	base.fail = errors.New("boom")
+	_, err = db.Exec(WithTraceID(ctx, "trace-1"), "DELETE FROM users")
+	assert.Error(t, err)
+
+	assert.Len(t, events, 5)
+	assert.Equal(t, "query", events[0].Op)
+	assert.Equal(t, int64(2), events[0].Rows)
+	assert.Equal(t, []any{0}, events[0].Args)
+	assert.Equal(t, "req-1", events[0].TraceID)
+	assert.Equal(t, "begin", events[1].Op)
+	assert.True(t, events[2].InTx)
+	assert.Equal(t, "commit", events[3].Op)
+	assert.Equal(t, "trace-1", events[4].TraceID)
+	assert.EqualError(t, events[4].Err, "boom")
+
+	stat := metrics.Snapshot()["main"]
+	assert.Equal(t, int64(5), stat.Count)
+	assert.Equal(t, int64(1), stat.Errors)
+	assert.Len(t, stat.Buckets, len(LatencyBuckets)+1)
+	assert.Equal(t, base, Unwrap(db))
+}
+
+func TestDBMgrHooks(t *testing.T) {
+	ctx := context.Background()
+	DefaultMetrics.Reset()
+	dm := &DBMgr{dbMap: map[string]ISQL{}, confMap: map[string]DBConf{}}
+	dm.AddHooks(SlowLog(0))
+	err := dm.Init(ctx, map[string]DBConf{"local": &jsonx.JObj{"db_url": "sqlite://:memory:", "metrics": true, "slow_ms": 1}})
+	assert.NoError(t, err)
+	defer dm.CloseAll(ctx)
+	db, _ := dm.Use("local")
+	assert.IsType(t, &SQLite{}, Unwrap(db))
+	_, err = db.Query(ctx, "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), DefaultMetrics.Snapshot()["local"].Count)
+
+	slow := 0
+	hook := WithHooks("local", db, AfterHook(func(ctx context.Context, ev *QueryEvent) {
+		if ev.Duration >= time.Nanosecond {
+			slow++
+		}
+	}))
+	_, err = hook.Query(ctx, "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, slow)
+	assert.Equal(t, int64(2), DefaultMetrics.Snapshot()["local"].Count, "appended to the existing chain")
+}
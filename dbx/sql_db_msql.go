@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/fengzhi09/golibx/jsonx"
 
@@ -19,6 +20,12 @@ type MSql struct {
 	dbType string
 }
 
+// sqlQuerier database/sql中连接池、连接与事务共有的查询能力
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 // Connect 建立数据库连接
 func (m *MSql) Connect(ctx context.Context) error {
 	// 具体实现由子类提供
@@ -29,17 +36,34 @@ func (m *MSql) Connect(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
+	tunePool(db, m.conf)
 
 	// 测试连接
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		db.Close()
-		return fmt.Errorf("failed to ping database: %v", err)
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	m.db = db
 	return nil
 }
 
+// tunePool 按配置调整连接池: pool_size/pool_min_idle/pool_idle_sec/pool_life_sec
+func tunePool(db *sql.DB, conf DBConf) {
+	if size := getIntOr(conf, "pool_size", 0); size > 0 {
+		db.SetMaxOpenConns(size)
+	}
+	if idle := getIntOr(conf, "pool_min_idle", 0); idle > 0 {
+		db.SetMaxIdleConns(idle)
+	}
+	if sec := getIntOr(conf, "pool_idle_sec", 0); sec > 0 {
+		db.SetConnMaxIdleTime(time.Duration(sec) * time.Second)
+	}
+	if sec := getIntOr(conf, "pool_life_sec", 0); sec > 0 {
+		db.SetConnMaxLifetime(time.Duration(sec) * time.Second)
+	}
+}
+
 // ConnString 构建MySQL连接字符串
 func (m *MSql) ConnString(conf DBConf) string {
 	url := getInOrder(conf, "db_url", "url", "my_url")
@@ -54,25 +78,193 @@ func (m *MSql) ConnString(conf DBConf) string {
 			user, password, host, port, dbname)
 	}
 
-	return strings.ReplaceAll(url, m.dbType+"://", "")
+	// go-sql-driver的DSN不带scheme
+	for _, scheme := range []string{"mysql://", "doris://"} {
+		if strings.HasPrefix(strings.ToLower(url), scheme) {
+			url = url[len(scheme):]
+		}
+	}
+	return url
 }
 
-// Query 执行MySQL查询
-func (m *MSql) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+// ensure 懒连接
+func (m *MSql) ensure(ctx context.Context) error {
 	if m.db == nil {
 		if err := m.Connect(ctx); err != nil {
-			return nil, fmt.Errorf("failed to connect: %v", err)
+			return fmt.Errorf("failed to connect: %w", err)
 		}
 	}
-	rows, err := m.db.Query(query, args...)
+	return nil
+}
+
+// Query 执行MySQL查询
+func (m *MSql) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	if err := m.ensure(ctx); err != nil {
+		return nil, err
+	}
+	return sqlQuery(ctx, m.db, m.dbType, query, args...)
+}
+
+// QueryEach 流式执行MySQL查询
+func (m *MSql) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	if err := m.ensure(ctx); err != nil {
+		return err
+	}
+	return sqlQueryEach(ctx, m.db, m.dbType, query, args, fn)
+}
+
+// Exec 执行MySQL写操作
+func (m *MSql) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	if err := m.ensure(ctx); err != nil {
+		return ExecResult{}, err
+	}
+	return sqlExec(ctx, m.db, m.dbType, query, args...)
+}
+
+// Dialect MySQL或Doris方言
+func (m *MSql) Dialect() Dialect {
+	return DialectOf(m.dbType)
+}
+
+// Begin 开启事务
+func (m *MSql) Begin(ctx context.Context) (ITx, error) {
+	if err := m.ensure(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("%v query error: %v", m.dbType, err)
+		return nil, fmt.Errorf("%v begin error: %w", m.dbType, err)
 	}
-	defer rows.Close()
+	return &MTx{tx: tx, dbType: m.dbType}, nil
+}
+
+// BulkInsert 批量写入：MySQL使用多行INSERT，Doris使用Stream Load
+func (m *MSql) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	if err := checkBulk(table, columns); err != nil {
+		return 0, err
+	}
+	if err := m.ensure(ctx); err != nil {
+		return 0, err
+	}
+	conf := newBulkConf(opts)
+	if m.Dialect() == DialectDoris {
+		return m.streamLoad(ctx, table, columns, rows, conf)
+	}
+	return sqlBulkInsert(ctx, m, table, columns, rows, conf)
+}
+
+// Tables 当前库的表与视图
+func (m *MSql) Tables(ctx context.Context) ([]Table, error) {
+	return schemaTables(ctx, m)
+}
+
+// Columns 表的列
+func (m *MSql) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, m, table)
+}
+
+// Indexes 表的索引
+func (m *MSql) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, m, table)
+}
+
+// PrimaryKey 表的主键列
+func (m *MSql) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, m, table)
+}
+
+// withLock 在独占连接上持有GET_LOCK执行fn；Doris不支持GET_LOCK，返回错误
+func (m *MSql) withLock(ctx context.Context, key string, fn func() error) error {
+	if m.Dialect() == DialectDoris {
+		return fmt.Errorf("%v has no session lock for %v, use WithoutLock if only one instance migrates", m.dbType, key)
+	}
+	if err := m.ensure(ctx); err != nil {
+		return err
+	}
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("%v conn error: %w", m.dbType, err)
+	}
+	defer conn.Close()
+	got := sql.NullInt64{}
+	timeout := getIntOr(m.conf, "lock_timeout_sec", 600)
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", key, timeout).Scan(&got); err != nil {
+		return fmt.Errorf("%v get lock error: %v", m.dbType, err)
+	}
+	if got.Int64 != 1 {
+		return fmt.Errorf("%v get lock %v timeout after %ds", m.dbType, key, timeout)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", key)
+	return fn()
+}
+
+// Close 关闭数据库连接（用于MySQL和Doris）
+func (m *MSql) Close(ctx context.Context) error {
+	if m.db != nil {
+		return m.db.Close()
+	}
+	return nil
+}
+
+type Doris = MSql
+
+// MTx database/sql事务（用于MySQL、Doris和SQLite）
+type MTx struct {
+	tx     *sql.Tx
+	dbType string
+}
+
+// Query 在事务中执行查询
+func (t *MTx) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	return sqlQuery(ctx, t.tx, t.dbType, query, args...)
+}
+
+// QueryEach 在事务中流式查询
+func (t *MTx) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	return sqlQueryEach(ctx, t.tx, t.dbType, query, args, fn)
+}
+
+// Exec 在事务中执行写操作
+func (t *MTx) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	return sqlExec(ctx, t.tx, t.dbType, query, args...)
+}
+
+// Dialect 事务所属数据库的方言
+func (t *MTx) Dialect() Dialect {
+	return DialectOf(t.dbType)
+}
+
+// Commit 提交事务
+func (t *MTx) Commit(ctx context.Context) error {
+	return t.tx.Commit()
+}
+
+// Rollback 回滚事务
+func (t *MTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback()
+}
+
+func sqlQuery(ctx context.Context, q sqlQuerier, dbType, query string, args ...any) ([]*jsonx.JObj, error) {
 	results := make([]*jsonx.JObj, 0)
+	err := sqlQueryEach(ctx, q, dbType, query, args, func(row *jsonx.JObj) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func sqlQueryEach(ctx context.Context, q sqlQuerier, dbType, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%v query error: %w", dbType, err)
+	}
+	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("%v get columns error: %v", m.dbType, err)
+		return fmt.Errorf("%v get columns error: %v", dbType, err)
 	}
 	values := make([]any, len(columns))
 	scanArgs := make([]any, len(columns))
@@ -82,27 +274,29 @@ func (m *MSql) Query(ctx context.Context, query string, args ...any) ([]*jsonx.J
 
 	for rows.Next() {
 		if err := rows.Scan(scanArgs...); err != nil {
-			return nil, fmt.Errorf("%v scan row error: %v", m.dbType, err)
+			return fmt.Errorf("%v scan row error: %v", dbType, err)
 		}
-		row := make(jsonx.JObj)
+		row := make(jsonx.JObj, len(columns))
 		for i, col := range columns {
 			row[col] = values[i]
 		}
-		results = append(results, &row)
+		if err := eachRow(ctx, fn, &row); err != nil {
+			return stopOrErr(err)
+		}
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("%v rows error: %v", m.dbType, err)
+		return fmt.Errorf("%v rows error: %w", dbType, err)
 	}
 
-	return results, nil
+	return nil
 }
 
-// Close 关闭数据库连接（用于MySQL和Doris）
-func (m *MSql) Close(ctx context.Context) error {
-	if m.db != nil {
-		return m.db.Close()
+func sqlExec(ctx context.Context, q sqlQuerier, dbType, query string, args ...any) (ExecResult, error) {
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("%v exec error: %w", dbType, err)
 	}
-	return nil
+	affected, _ := res.RowsAffected()
+	lastId, _ := res.LastInsertId()
+	return ExecResult{RowsAffected: affected, LastInsertId: lastId}, nil
 }
-
-type Doris = MSql
@@ -3,20 +3,30 @@ package dbx
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/fengzhi09/golibx/jsonx"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// PSql PostgreSQL数据库基类（使用pgx）
+// PSql PostgreSQL数据库基类（使用pgxpool）
 type PSql struct {
 	name   string
 	conf   DBConf
-	db     *pgx.Conn
+	db     *pgxpool.Pool
 	dbType string
 }
 
+// pgxQuerier pgx连接池、连接与事务共有的查询能力
+type pgxQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
 // ConnString 构建PostgreSQL连接字符串
 func (p *PSql) ConnString(conf DBConf) string {
 	url := getInOrder(conf, "db_url", "url", "pg_url", "driver")
@@ -34,47 +44,274 @@ func (p *PSql) ConnString(conf DBConf) string {
 	return fmt.Sprintf("postgres://%s:%s@%v:%v/%v?sslmode=disable", user, password, host, port, dbname)
 }
 
-// Connect 建立PostgreSQL基础连接
+// PoolConfig 构建连接池配置: pool_size/pool_min_idle/pool_idle_sec/pool_life_sec
+func (p *PSql) PoolConfig(conf DBConf) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(p.ConnString(conf))
+	if err != nil {
+		return nil, err
+	}
+	if size := getIntOr(conf, "pool_size", 0); size > 0 {
+		cfg.MaxConns = int32(size)
+	}
+	if idle := getIntOr(conf, "pool_min_idle", 0); idle > 0 {
+		cfg.MinConns = int32(idle)
+	}
+	if sec := getIntOr(conf, "pool_idle_sec", 0); sec > 0 {
+		cfg.MaxConnIdleTime = time.Duration(sec) * time.Second
+	}
+	if sec := getIntOr(conf, "pool_life_sec", 0); sec > 0 {
+		cfg.MaxConnLifetime = time.Duration(sec) * time.Second
+	}
+	return cfg, nil
+}
+
+// Connect 建立PostgreSQL连接池
 func (p *PSql) Connect(ctx context.Context) error {
-	// 由子类实现具体连接逻辑
-	// 构建连接字符串
-	connStr := p.ConnString(p.conf)
-	db, err := pgx.Connect(ctx, connStr)
+	cfg, err := p.PoolConfig(p.conf)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
 
 	// 测试连接
 	if err := db.Ping(ctx); err != nil {
-		db.Close(ctx)
-		return fmt.Errorf("failed to ping database: %v", err)
+		db.Close()
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	p.db = db
 	return nil
 }
 
-// Close 关闭PostgreSQL连接
+// Close 关闭PostgreSQL连接池
 func (p *PSql) Close(ctx context.Context) error {
 	if p.db != nil {
-		return p.db.Close(ctx)
+		p.db.Close()
 	}
 	return nil
 }
 
-// Query 执行PostgreSQL查询
-func (p *PSql) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+// ensure 懒连接
+func (p *PSql) ensure(ctx context.Context) error {
 	if p.db == nil {
 		if err := p.Connect(ctx); err != nil {
-			return nil, fmt.Errorf("failed to connect: %v", err)
+			return fmt.Errorf("failed to connect: %w", err)
 		}
 	}
-	rows, err := p.db.Query(ctx, query, args...)
+	return nil
+}
+
+// Query 执行PostgreSQL查询
+func (p *PSql) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	if err := p.ensure(ctx); err != nil {
+		return nil, err
+	}
+	return pgxQuery(ctx, p.db, p.dbType, query, args...)
+}
+
+// QueryEach 流式执行PostgreSQL查询
+func (p *PSql) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	if err := p.ensure(ctx); err != nil {
+		return err
+	}
+	return pgxQueryEach(ctx, p.db, p.dbType, query, args, fn)
+}
+
+// Exec 执行PostgreSQL写操作
+func (p *PSql) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	if err := p.ensure(ctx); err != nil {
+		return ExecResult{}, err
+	}
+	return pgxExec(ctx, p.db, p.dbType, query, args...)
+}
+
+// Dialect PostgreSQL方言
+func (p *PSql) Dialect() Dialect {
+	return DialectPostgres
+}
+
+// Begin 开启PostgreSQL事务
+func (p *PSql) Begin(ctx context.Context) (ITx, error) {
+	if err := p.ensure(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := p.db.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("%v query error: %v", p.dbType, err)
+		return nil, fmt.Errorf("%v begin error: %w", p.dbType, err)
 	}
-	defer rows.Close()
+	return &PTx{tx: tx, dbType: p.dbType}, nil
+}
+
+// BulkInsert 批量写入：使用COPY，Ignore/Update冲突策略下经临时表中转
+func (p *PSql) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	if err := checkBulk(table, columns); err != nil {
+		return 0, err
+	}
+	if err := p.ensure(ctx); err != nil {
+		return 0, err
+	}
+	conf := newBulkConf(opts)
+	ident := pgx.Identifier(strings.Split(table, "."))
+	if conf.Conflict == ConflictError {
+		return conf.eachBatch(rows, func(batch [][]any) (int64, error) {
+			n, err := p.db.CopyFrom(ctx, ident, columns, pgx.CopyFromRows(batch))
+			if err != nil {
+				return n, fmt.Errorf("%v copy error: %v", p.dbType, err)
+			}
+			return n, nil
+		})
+	}
+	clause, err := conflictClause(DialectPostgres, table, columns, conf.Keys, conf.Conflict == ConflictIgnore)
+	if err != nil {
+		return 0, err
+	}
+	cols := make([]string, len(columns))
+	for i, col := range columns {
+		cols[i] = DialectPostgres.Quote(col)
+	}
+	const tmp = "_dbx_bulk"
+	merge := fmt.Sprintf("INSERT INTO %v (%v) SELECT %v FROM %v%v",
+		DialectPostgres.Quote(table), strings.Join(cols, ", "), strings.Join(cols, ", "), tmp, clause)
+	return conf.eachBatch(rows, func(batch [][]any) (int64, error) {
+		// 与MySQL一致，Update策略按输入行数返回，不计去重掉的行
+		inputs := int64(len(batch))
+		if conf.Conflict == ConflictUpdate {
+			batch = dedupeRows(batch, columns, conf.Keys)
+		}
+		n := int64(0)
+		err := pgx.BeginFunc(ctx, p.db, func(tx pgx.Tx) error {
+			create := fmt.Sprintf("CREATE TEMP TABLE %v (LIKE %v INCLUDING DEFAULTS) ON COMMIT DROP", tmp, DialectPostgres.Quote(table))
+			if _, err := tx.Exec(ctx, create); err != nil {
+				return err
+			}
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{tmp}, columns, pgx.CopyFromRows(batch)); err != nil {
+				return err
+			}
+			tag, err := tx.Exec(ctx, merge)
+			n = tag.RowsAffected()
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%v bulk merge error: %v", p.dbType, err)
+		}
+		if conf.Conflict == ConflictUpdate {
+			return inputs, nil
+		}
+		return n, nil
+	})
+}
+
+// Tables 当前schema的表与视图
+func (p *PSql) Tables(ctx context.Context) ([]Table, error) {
+	return schemaTables(ctx, p)
+}
+
+// Columns 表的列
+func (p *PSql) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, p, table)
+}
+
+// Indexes 表的索引
+func (p *PSql) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, p, table)
+}
+
+// PrimaryKey 表的主键列
+func (p *PSql) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, p, table)
+}
+
+// withLock 在独占连接上持有会话级advisory lock执行fn；
+// 以pg_try_advisory_lock重试，超过lock_timeout_sec(默认600)返回错误
+func (p *PSql) withLock(ctx context.Context, key string, fn func() error) error {
+	if err := p.ensure(ctx); err != nil {
+		return err
+	}
+	conn, err := p.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("%v acquire error: %w", p.dbType, err)
+	}
+	defer conn.Release()
+	timeout := getIntOr(p.conf, "lock_timeout_sec", 600)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		got := false
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&got); err != nil {
+			return fmt.Errorf("%v advisory lock error: %v", p.dbType, err)
+		}
+		if got {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%v advisory lock %v timeout after %ds", p.dbType, key, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock(hashtext($1))", key)
+	return fn()
+}
+
+// PTx PostgreSQL事务
+type PTx struct {
+	tx     pgx.Tx
+	dbType string
+}
+
+// Query 在事务中执行查询
+func (t *PTx) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	return pgxQuery(ctx, t.tx, t.dbType, query, args...)
+}
+
+// QueryEach 在事务中流式查询
+func (t *PTx) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	return pgxQueryEach(ctx, t.tx, t.dbType, query, args, fn)
+}
+
+// Exec 在事务中执行写操作
+func (t *PTx) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	return pgxExec(ctx, t.tx, t.dbType, query, args...)
+}
+
+// Dialect PostgreSQL方言
+func (t *PTx) Dialect() Dialect {
+	return DialectPostgres
+}
+
+// Commit 提交事务
+func (t *PTx) Commit(ctx context.Context) error {
+	return t.tx.Commit(ctx)
+}
+
+// Rollback 回滚事务
+func (t *PTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback(ctx)
+}
+
+func pgxQuery(ctx context.Context, q pgxQuerier, dbType, query string, args ...any) ([]*jsonx.JObj, error) {
 	results := make([]*jsonx.JObj, 0)
+	err := pgxQueryEach(ctx, q, dbType, query, args, func(row *jsonx.JObj) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func pgxQueryEach(ctx context.Context, q pgxQuerier, dbType, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%v query error: %w", dbType, err)
+	}
+	defer rows.Close()
 	fieldDescriptions := rows.FieldDescriptions()
 	columns := make([]string, len(fieldDescriptions))
 	for i, fd := range fieldDescriptions {
@@ -87,17 +324,27 @@ func (p *PSql) Query(ctx context.Context, query string, args ...any) ([]*jsonx.J
 	}
 	for rows.Next() {
 		if err := rows.Scan(scanArgs...); err != nil {
-			return nil, fmt.Errorf("%v scan row error: %v", p.dbType, err)
+			return fmt.Errorf("%v scan row error: %v", dbType, err)
 		}
-		row := make(jsonx.JObj)
+		row := make(jsonx.JObj, len(columns))
 		for i, col := range columns {
 			row[col] = values[i]
 		}
-		results = append(results, &row)
+		if err := eachRow(ctx, fn, &row); err != nil {
+			return stopOrErr(err)
+		}
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("%v rows error: %v", p.dbType, err)
+		return fmt.Errorf("%v rows error: %w", dbType, err)
 	}
 
-	return results, nil
+	return nil
+}
+
+func pgxExec(ctx context.Context, q pgxQuerier, dbType, query string, args ...any) (ExecResult, error) {
+	tag, err := q.Exec(ctx, query, args...)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("%v exec error: %w", dbType, err)
+	}
+	return ExecResult{RowsAffected: tag.RowsAffected()}, nil
 }
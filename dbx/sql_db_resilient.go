@@ -0,0 +1,363 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrBreakerOpen 熔断打开期间的调用直接失败
+var ErrBreakerOpen = errors.New("dbx: circuit breaker open")
+
+// transientPgCodes 可重试的PostgreSQL错误码: 序列化失败、死锁、连接过多、实例重启中
+var transientPgCodes = map[string]bool{
+	"40001": true, "40P01": true, "53300": true, "57P01": true, "57P02": true, "57P03": true,
+}
+
+// transientMyCodes 可重试的MySQL错误码: 死锁、锁等待超时、连接过多
+var transientMyCodes = map[uint16]bool{
+	1213: true, 1205: true, 1040: true, 1203: true,
+}
+
+// IsTransient 是否为重试即可能成功的错误(序列化失败、死锁、连接过多等)，此类错误时语句未生效
+func IsTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return transientPgCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08")
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return transientMyCodes[myErr.Number]
+	}
+	return false
+}
+
+// IsConnError 是否为连接断开、拒绝等网络层错误
+func IsConnError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		pgconn.SafeToRetry(err) || strings.Contains(err.Error(), "conn closed")
+}
+
+// retryRead 读操作可重试: 瞬时错误或连接错误
+func retryRead(err error) bool {
+	return IsTransient(err) || IsConnError(err)
+}
+
+// retryWrite 写操作可重试: 瞬时错误，或确定语句未发出的连接错误
+func retryWrite(err error) bool {
+	return IsTransient(err) || pgconn.SafeToRetry(err) || errors.Is(err, driver.ErrBadConn)
+}
+
+// BreakerState 熔断状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常
+	BreakerOpen                         // 熔断，调用直接失败
+	BreakerHalfOpen                     // 冷却结束，放行一个探测调用
+)
+
+// String 状态名
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker 熔断器：连续threshold次连接类失败后打开，cooldown后半开放行一个探测调用
+type Breaker struct {
+	mutex     sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+	lastErr   error
+}
+
+// NewBreaker 创建熔断器，threshold<=0时不熔断
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow 是否放行本次调用
+func (b *Breaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrBreakerOpen
+		}
+		b.state, b.probing = BreakerHalfOpen, true
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrBreakerOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Done 记录调用结果；只有连接类错误与连接数耗尽计为失败，SQL错误说明数据库可用；
+// 调用方的ctx取消或超时不能说明数据库状态，既不计为失败也不清零
+func (b *Breaker) Done(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	failed := IsConnError(err) || isTooManyConns(err)
+	if !failed {
+		b.state, b.failures = BreakerClosed, 0
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.threshold > 0 && (b.state == BreakerHalfOpen || b.failures >= b.threshold) {
+		b.state, b.openedAt = BreakerOpen, time.Now()
+	}
+}
+
+// State 当前状态
+func (b *Breaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Status 健康检查信息
+func (b *Breaker) Status() jsonx.JObj {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	status := jsonx.JObj{"state": b.state.String(), "failures": b.failures}
+	if b.lastErr != nil {
+		status["last_error"] = b.lastErr.Error()
+	}
+	if b.state == BreakerOpen {
+		status["opened_at"] = b.openedAt.Format(time.DateTime)
+	}
+	return status
+}
+
+// isTooManyConns 连接数耗尽
+func isTooManyConns(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "53300"
+	}
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && (myErr.Number == 1040 || myErr.Number == 1203)
+}
+
+// ResilientSQL 为ISQL增加重试与熔断；事务内的语句不重试。
+// 不自行重连：连接池丢弃断开的连接，重试时从池中取得新连接
+type ResilientSQL struct {
+	name       string
+	db         ISQL
+	maxRetry   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	breaker    *Breaker
+}
+
+// WithResilience 按配置包装db: retry_max(默认2)、retry_backoff_ms(默认50)、retry_max_backoff_ms(默认2000)、
+// breaker_failures(默认5，0关闭熔断)、breaker_open_sec(默认30)
+func WithResilience(name string, db ISQL, conf DBConf) *ResilientSQL {
+	return &ResilientSQL{
+		name:       name,
+		db:         db,
+		maxRetry:   getIntOr(conf, "retry_max", 2),
+		backoff:    time.Duration(getIntOr(conf, "retry_backoff_ms", 50)) * time.Millisecond,
+		maxBackoff: time.Duration(getIntOr(conf, "retry_max_backoff_ms", 2000)) * time.Millisecond,
+		breaker:    NewBreaker(getIntOr(conf, "breaker_failures", 5), time.Duration(getIntOr(conf, "breaker_open_sec", 30))*time.Second),
+	}
+}
+
+// Breaker 熔断器
+func (r *ResilientSQL) Breaker() *Breaker {
+	return r.breaker
+}
+
+// Unwrap 被装饰的ISQL
+func (r *ResilientSQL) Unwrap() ISQL {
+	return r.db
+}
+
+// do 经熔断器执行fn，retryable的错误按指数退避(带抖动)重试
+func (r *ResilientSQL) do(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := r.breaker.Allow(); err != nil {
+			return err
+		}
+		err := fn()
+		r.breaker.Done(err)
+		if err == nil || attempt >= r.maxRetry || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		wait := min(r.backoff<<attempt, r.maxBackoff)
+		wait = wait/2 + rand.N(wait/2+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Query 查询，瞬时错误与断线时重试
+func (r *ResilientSQL) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	var rows []*jsonx.JObj
+	err := r.do(ctx, retryRead, func() error {
+		var err error
+		rows, err = r.db.Query(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryEach 流式查询，仅在尚未回调任何行时重试
+func (r *ResilientSQL) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	delivered := false
+	return r.do(ctx, func(err error) bool { return !delivered && retryRead(err) }, func() error {
+		return r.db.QueryEach(ctx, query, args, func(row *jsonx.JObj) error {
+			delivered = true
+			return fn(row)
+		})
+	})
+}
+
+// Exec 写操作，仅在确定未生效的错误时重试
+func (r *ResilientSQL) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	var res ExecResult
+	err := r.do(ctx, retryWrite, func() error {
+		var err error
+		res, err = r.db.Exec(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+// Dialect 底层方言
+func (r *ResilientSQL) Dialect() Dialect {
+	return r.db.Dialect()
+}
+
+// Connect 建立连接
+func (r *ResilientSQL) Connect(ctx context.Context) error {
+	return r.db.Connect(ctx)
+}
+
+// Begin 开启事务，连接错误时重试
+func (r *ResilientSQL) Begin(ctx context.Context) (ITx, error) {
+	var tx ITx
+	err := r.do(ctx, retryRead, func() error {
+		var err error
+		tx, err = r.db.Begin(ctx)
+		return err
+	})
+	return tx, err
+}
+
+// BulkInsert 批量写入，经熔断器但不重试(可能已部分写入)
+func (r *ResilientSQL) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	var n int64
+	err := r.do(ctx, func(error) bool { return false }, func() error {
+		var err error
+		n, err = r.db.BulkInsert(ctx, table, columns, rows, opts...)
+		return err
+	})
+	return n, err
+}
+
+// Tables 表与视图
+func (r *ResilientSQL) Tables(ctx context.Context) ([]Table, error) {
+	return schemaTables(ctx, r)
+}
+
+// Columns 表的列
+func (r *ResilientSQL) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, r, table)
+}
+
+// Indexes 表的索引
+func (r *ResilientSQL) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, r, table)
+}
+
+// PrimaryKey 表的主键列
+func (r *ResilientSQL) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, r, table)
+}
+
+// withLock 使用底层的会话锁
+func (r *ResilientSQL) withLock(ctx context.Context, key string, fn func() error) error {
+	return withDBLock(ctx, r.db, key, fn)
+}
+
+// Close 关闭连接
+func (r *ResilientSQL) Close(ctx context.Context) error {
+	return r.db.Close(ctx)
+}
+
+// Breakers 各库的熔断器，用于健康检查；读写分离的从库名为name[i]
+func (dm *DBMgr) Breakers() map[string]*Breaker {
+	dm.mutex.RLock()
+	defer dm.mutex.RUnlock()
+	breakers := make(map[string]*Breaker)
+	for _, db := range dm.dbMap {
+		collectBreakers(db, breakers)
+	}
+	return breakers
+}
+
+// collectBreakers 逐层拆开装饰器收集熔断器
+func collectBreakers(db ISQL, breakers map[string]*Breaker) {
+	for {
+		switch v := db.(type) {
+		case *ResilientSQL:
+			breakers[v.name] = v.breaker
+			return
+		case *RouteSQL:
+			for _, sub := range append([]ISQL{v.primary}, v.replicaDBs()...) {
+				collectBreakers(sub, breakers)
+			}
+			return
+		}
+		w, ok := db.(interface{ Unwrap() ISQL })
+		if !ok {
+			return
+		}
+		db = w.Unwrap()
+	}
+}
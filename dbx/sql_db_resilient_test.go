@@ -0,0 +1,148 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakySQL 前几次调用依次返回errs中的错误
+type flakySQL struct {
+	*fakeSQL
+	errs []error
+}
+
+func (f *flakySQL) pop() error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakySQL) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	f.execs = append(f.execs, query)
+	if err := f.pop(); err != nil {
+		return nil, err
+	}
+	return f.rows, nil
+}
+
+func (f *flakySQL) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	f.execs = append(f.execs, query)
+	if err := f.pop(); err != nil {
+		return ExecResult{}, err
+	}
+	return ExecResult{RowsAffected: 1}, nil
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, IsTransient(&pgconn.PgError{Code: "40P01"}))
+	assert.True(t, IsTransient(&pgconn.PgError{Code: "53300"}))
+	assert.False(t, IsTransient(&pgconn.PgError{Code: "23505"}))
+	assert.True(t, IsTransient(&mysql.MySQLError{Number: 1213}))
+	assert.False(t, IsTransient(&mysql.MySQLError{Number: 1062}))
+
+	assert.True(t, IsConnError(driver.ErrBadConn))
+	assert.True(t, IsConnError(errors.Join(errors.New("query"), io.ErrUnexpectedEOF)))
+	assert.False(t, IsConnError(context.DeadlineExceeded))
+	assert.False(t, IsConnError(&pgconn.PgError{Code: "23505"}))
+}
+
+func TestResilientRetry(t *testing.T) {
+	ctx := context.Background()
+	conf := &jsonx.JObj{"retry_max": 2, "retry_backoff_ms": 1}
+	db := &flakySQL{fakeSQL: &fakeSQL{fakeQuery: &fakeQuery{rows: []*jsonx.JObj{{"id": 1}}}}}
+	r := WithResilience("main", db, conf)
+
+	// 断线后重试成功
+	db.errs = []error{io.ErrUnexpectedEOF, &pgconn.PgError{Code: "40P01"}}
+	rows, err := r.Query(ctx, "SELECT 1")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Len(t, db.execs, 3)
+
+	// 超过重试次数
+	db.execs = nil
+	db.errs = []error{driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn}
+	_, err = r.Query(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Len(t, db.execs, 3)
+
+	// 约束冲突不重试
+	db.execs = nil
+	db.errs = []error{&pgconn.PgError{Code: "23505"}}
+	_, err = r.Exec(ctx, "INSERT INTO t VALUES (1)")
+	assert.Error(t, err)
+	assert.Len(t, db.execs, 1)
+
+	// 写操作在可能已生效的断线错误上不重试
+	db.execs = nil
+	db.errs = []error{io.ErrUnexpectedEOF}
+	_, err = r.Exec(ctx, "INSERT INTO t VALUES (1)")
+	assert.Error(t, err)
+	assert.Len(t, db.execs, 1)
+
+	// 死锁时语句已回滚，写操作可重试
+	db.execs = nil
+	db.errs = []error{&mysql.MySQLError{Number: 1213}}
+	_, err = r.Exec(ctx, "UPDATE t SET n = n + 1")
+	assert.NoError(t, err)
+	assert.Len(t, db.execs, 2)
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	conf := &jsonx.JObj{"retry_max": 0, "breaker_failures": 2, "breaker_open_sec": 1}
+	db := &flakySQL{fakeSQL: &fakeSQL{fakeQuery: &fakeQuery{}}}
+	r := WithResilience("main", db, conf)
+	b := r.Breaker()
+
+	// SQL错误不计入熔断
+	db.errs = []error{&pgconn.PgError{Code: "42P01"}, &pgconn.PgError{Code: "42P01"}}
+	r.Query(ctx, "SELECT * FROM missing")
+	r.Query(ctx, "SELECT * FROM missing")
+	assert.Equal(t, BreakerClosed, b.State())
+
+	db.errs = []error{driver.ErrBadConn, driver.ErrBadConn}
+	r.Query(ctx, "SELECT 1")
+	assert.Equal(t, BreakerClosed, b.State())
+	// 调用方ctx取消或超时既不计入也不清零
+	db.errs = []error{context.DeadlineExceeded, context.Canceled}
+	r.Query(ctx, "SELECT 1")
+	r.Query(ctx, "SELECT 1")
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.Equal(t, 1, b.Status().GetInt("failures"))
+	db.errs = []error{driver.ErrBadConn}
+	r.Query(ctx, "SELECT 1")
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.Equal(t, "open", b.Status().GetStr("state"))
+
+	// 熔断期间直接失败，不访问数据库
+	db.execs = nil
+	_, err := r.Query(ctx, "SELECT 1")
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Empty(t, db.execs)
+
+	// 冷却后放行一个探测，成功则恢复
+	b.mutex.Lock()
+	b.openedAt = time.Now().Add(-2 * time.Second)
+	b.mutex.Unlock()
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	_, err = r.Query(ctx, "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	dm := &DBMgr{dbMap: map[string]ISQL{"main": WithHooks("main", r, DefaultMetrics)}}
+	assert.Same(t, b, dm.Breakers()["main"])
+}
@@ -0,0 +1,270 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+)
+
+// 读写分离路由策略
+const (
+	RouteRoundRobin = "round_robin"
+	RouteLatency    = "latency"
+)
+
+// RouteSQL 读写分离：Query/QueryEach路由到健康的从库，Exec、事务与批量写入走主库
+type RouteSQL struct {
+	name     string
+	primary  ISQL
+	replicas []*replica
+	policy   string
+	interval time.Duration
+	timeout  time.Duration
+	next     atomic.Uint64
+	stop     chan struct{}
+	done     sync.WaitGroup
+}
+
+// replica 从库及其健康状态
+type replica struct {
+	db      ISQL
+	healthy atomic.Bool
+	latency atomic.Int64 // 健康检查耗时的滑动平均(ns)
+}
+
+// ReplicaStatus 从库健康状态
+type ReplicaStatus struct {
+	Index   int
+	Healthy bool
+	Latency time.Duration
+}
+
+type primaryKey struct{}
+
+// WithPrimary 标记上下文强制读主库，用于写后立即读
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// isPrimary 上下文是否强制读主库
+func isPrimary(ctx context.Context) bool {
+	force, _ := ctx.Value(primaryKey{}).(bool)
+	return force
+}
+
+// NewRouteSQL 创建读写分离实例；conf可配置route_policy(round_robin/latency)、health_sec(默认10)、health_timeout_ms(默认1000)
+func NewRouteSQL(name string, conf DBConf, primary ISQL, replicas ...ISQL) *RouteSQL {
+	r := &RouteSQL{
+		name:     name,
+		primary:  primary,
+		policy:   getOrDefault(conf, "route_policy", RouteRoundRobin),
+		interval: time.Duration(getIntOr(conf, "health_sec", 10)) * time.Second,
+		timeout:  time.Duration(getIntOr(conf, "health_timeout_ms", 1000)) * time.Millisecond,
+	}
+	for _, db := range replicas {
+		r.replicas = append(r.replicas, &replica{db: db})
+	}
+	return r
+}
+
+// routeConf 由父配置与primary/replicas小节合并出单库配置；小节给出连接地址时忽略父配置的地址
+func routeConf(parent DBConf, section jsonx.JObj) DBConf {
+	conf := parent.Clone()
+	for _, key := range []string{"primary", "replicas", "route_policy", "health_sec", "health_timeout_ms"} {
+		delete(conf, key)
+	}
+	urlKeys := []string{"db_url", "url", "pg_url", "my_url"}
+	for _, key := range urlKeys {
+		if section.Contains(key) {
+			for _, k := range urlKeys {
+				delete(conf, k)
+			}
+			break
+		}
+	}
+	conf.Merge(section)
+	return &conf
+}
+
+// Connect 连接主库与从库；从库连接失败只标记为不健康
+func (r *RouteSQL) Connect(ctx context.Context) error {
+	if err := r.primary.Connect(ctx); err != nil {
+		return fmt.Errorf("primary: %v", err)
+	}
+	for i, rep := range r.replicas {
+		if err := rep.db.Connect(ctx); err != nil {
+			logx.WarnfM(ctx, "dbx", "连接从库 %s[%d] 失败: %v", r.name, i, err)
+			continue
+		}
+		r.check(ctx, i, rep)
+	}
+	if r.interval > 0 && len(r.replicas) > 0 && r.stop == nil {
+		r.stop = make(chan struct{})
+		r.done.Add(1)
+		go r.healthLoop(context.WithoutCancel(ctx))
+	}
+	return nil
+}
+
+// healthLoop 定期检查从库健康
+func (r *RouteSQL) healthLoop(ctx context.Context) {
+	defer r.done.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			for i, rep := range r.replicas {
+				r.check(ctx, i, rep)
+			}
+		}
+	}
+}
+
+// check 以SELECT 1探测从库，记录健康与耗时
+func (r *RouteSQL) check(ctx context.Context, i int, rep *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	_, err := rep.db.Query(ctx, "SELECT 1")
+	cost := time.Since(start)
+	if err != nil {
+		if rep.healthy.Swap(false) {
+			logx.WarnfM(ctx, "dbx", "从库 %s[%d] 健康检查失败: %v", r.name, i, err)
+		}
+		return
+	}
+	if old := rep.latency.Load(); old > 0 && rep.healthy.Load() {
+		cost = time.Duration(old*7/10 + int64(cost)*3/10)
+	}
+	rep.latency.Store(int64(cost))
+	if !rep.healthy.Swap(true) {
+		logx.InfofM(ctx, "dbx", "从库 %s[%d] 恢复健康", r.name, i)
+	}
+}
+
+// reader 选择读库：强制主库或无健康从库时返回主库
+func (r *RouteSQL) reader(ctx context.Context) IQuery {
+	if isPrimary(ctx) {
+		return r.primary
+	}
+	healthy := make([]*replica, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		if rep.healthy.Load() {
+			healthy = append(healthy, rep)
+		}
+	}
+	if len(healthy) == 0 {
+		return r.primary
+	}
+	if r.policy == RouteLatency {
+		best := healthy[0]
+		for _, rep := range healthy[1:] {
+			if rep.latency.Load() < best.latency.Load() {
+				best = rep
+			}
+		}
+		return best.db
+	}
+	return healthy[r.next.Add(1)%uint64(len(healthy))].db
+}
+
+// Replicas 从库健康状态
+func (r *RouteSQL) Replicas() []ReplicaStatus {
+	status := make([]ReplicaStatus, len(r.replicas))
+	for i, rep := range r.replicas {
+		status[i] = ReplicaStatus{Index: i, Healthy: rep.healthy.Load(), Latency: time.Duration(rep.latency.Load())}
+	}
+	return status
+}
+
+// Primary 主库
+func (r *RouteSQL) Primary() ISQL {
+	return r.primary
+}
+
+// Query 在从库执行查询
+func (r *RouteSQL) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	return r.reader(ctx).Query(ctx, query, args...)
+}
+
+// QueryEach 在从库流式查询
+func (r *RouteSQL) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	return r.reader(ctx).QueryEach(ctx, query, args, fn)
+}
+
+// Exec 在主库执行写操作
+func (r *RouteSQL) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	return r.primary.Exec(ctx, query, args...)
+}
+
+// Dialect 主库方言
+func (r *RouteSQL) Dialect() Dialect {
+	return r.primary.Dialect()
+}
+
+// Begin 在主库开启事务
+func (r *RouteSQL) Begin(ctx context.Context) (ITx, error) {
+	return r.primary.Begin(ctx)
+}
+
+// BulkInsert 在主库批量写入
+func (r *RouteSQL) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	return r.primary.BulkInsert(ctx, table, columns, rows, opts...)
+}
+
+// Tables 从库(读库)的表与视图
+func (r *RouteSQL) Tables(ctx context.Context) ([]Table, error) {
+	return schemaTables(ctx, r)
+}
+
+// Columns 表的列
+func (r *RouteSQL) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, r, table)
+}
+
+// Indexes 表的索引
+func (r *RouteSQL) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, r, table)
+}
+
+// PrimaryKey 表的主键列
+func (r *RouteSQL) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, r, table)
+}
+
+// withLock 使用主库的会话锁
+func (r *RouteSQL) withLock(ctx context.Context, key string, fn func() error) error {
+	return withDBLock(ctx, r.primary, key, fn)
+}
+
+// Close 停止健康检查并关闭主库与从库
+func (r *RouteSQL) Close(ctx context.Context) error {
+	if r.stop != nil {
+		close(r.stop)
+		r.done.Wait()
+		r.stop = nil
+	}
+	var first error
+	for _, db := range append([]ISQL{r.primary}, r.replicaDBs()...) {
+		if err := db.Close(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (r *RouteSQL) replicaDBs() []ISQL {
+	dbs := make([]ISQL, len(r.replicas))
+	for i, rep := range r.replicas {
+		dbs[i] = rep.db
+	}
+	return dbs
+}
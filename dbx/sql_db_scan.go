@@ -0,0 +1,393 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// ErrNoRows 查询结果为空
+var ErrNoRows = errors.New("dbx: no rows in result set")
+
+// MapError 列与结构体字段映射失败
+type MapError struct {
+	Type     string   // 目标结构体
+	Unmapped []string // 结果中存在但结构体无对应字段的列
+	Missing  []string // 结构体以db标签声明但结果中不存在的列
+}
+
+func (e *MapError) Error() string {
+	parts := make([]string, 0, 2)
+	if len(e.Unmapped) > 0 {
+		parts = append(parts, fmt.Sprintf("unmapped columns %v", e.Unmapped))
+	}
+	if len(e.Missing) > 0 {
+		parts = append(parts, fmt.Sprintf("missing columns %v", e.Missing))
+	}
+	return fmt.Sprintf("dbx: map rows to %v failed: %v", e.Type, strings.Join(parts, "; "))
+}
+
+// QueryAs 执行查询并将每行按db/json标签映射为T(结构体或结构体指针)
+func QueryAs[T any](ctx context.Context, db IQuery, query string, args ...any) ([]T, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return RowsAs[T](rows)
+}
+
+// QueryOne 执行查询并映射第一行，无结果时返回ErrNoRows
+func QueryOne[T any](ctx context.Context, db IQuery, query string, args ...any) (T, error) {
+	rows, err := QueryAs[T](ctx, db, query, args...)
+	if err != nil {
+		return *new(T), err
+	}
+	if len(rows) == 0 {
+		return *new(T), ErrNoRows
+	}
+	return rows[0], nil
+}
+
+// RowsAs 将查询结果映射为T，首行校验列映射
+func RowsAs[T any](rows []*jsonx.JObj) ([]T, error) {
+	results := make([]T, 0, len(rows))
+	if len(rows) == 0 {
+		return results, nil
+	}
+	info, err := structInfoOf(reflect.TypeOf(*new(T)))
+	if err != nil {
+		return nil, err
+	}
+	if err := info.check(rows[0].Keys()); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		item, err := rowAs[T](info, row)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	return results, nil
+}
+
+// RowAs 将单行映射为T，不校验列映射
+func RowAs[T any](row *jsonx.JObj) (T, error) {
+	info, err := structInfoOf(reflect.TypeOf(*new(T)))
+	if err != nil {
+		return *new(T), err
+	}
+	return rowAs[T](info, row)
+}
+
+func rowAs[T any](info *structInfo, row *jsonx.JObj) (T, error) {
+	var item T
+	target := reflect.ValueOf(&item).Elem()
+	if info.ptr {
+		target.Set(reflect.New(info.typ))
+		target = target.Elem()
+	}
+	for col, raw := range *row {
+		field, hit := info.lookup(col)
+		if !hit {
+			continue
+		}
+		if err := assignValue(fieldByIndex(target, field.index), raw); err != nil {
+			return item, fmt.Errorf("dbx: scan column %v into %v.%v failed: %v", col, info.typ, field.name, err)
+		}
+	}
+	return item, nil
+}
+
+type fieldInfo struct {
+	name     string
+	column   string
+	index    []int
+	required bool
+}
+
+type structInfo struct {
+	typ    reflect.Type
+	ptr    bool
+	fields map[string]*fieldInfo // 列名(小写) => 字段
+}
+
+var structInfoCache sync.Map
+
+func structInfoOf(typ reflect.Type) (*structInfo, error) {
+	if typ == nil {
+		return nil, fmt.Errorf("dbx: map target must be a struct")
+	}
+	if cached, hit := structInfoCache.Load(typ); hit {
+		return cached.(*structInfo), nil
+	}
+	info := &structInfo{typ: typ, fields: map[string]*fieldInfo{}}
+	if typ.Kind() == reflect.Ptr {
+		info.ptr, info.typ = true, typ.Elem()
+	}
+	if info.typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dbx: map target must be a struct, got %v", typ)
+	}
+	collectFields(info, info.typ, nil)
+	structInfoCache.Store(typ, info)
+	return info, nil
+}
+
+func collectFields(info *structInfo, typ reflect.Type, parent []int) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		index := append(append([]int{}, parent...), i)
+		if sf.Anonymous && !isScannable(sf.Type) {
+			embedded := sf.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectFields(info, embedded, index)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		column, required := columnOf(sf)
+		if column == "" {
+			continue
+		}
+		key := strings.ToLower(column)
+		if _, hit := info.fields[key]; hit && len(parent) > 0 {
+			// 外层字段优先于内嵌字段
+			continue
+		}
+		info.fields[key] = &fieldInfo{name: sf.Name, column: column, index: index, required: required}
+	}
+}
+
+// columnOf 解析字段对应列名: db标签(声明即必需) > json标签 > 字段名蛇形
+func columnOf(sf reflect.StructField) (string, bool) {
+	if tag, ok := sf.Tag.Lookup("db"); ok {
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, false
+		}
+	}
+	return snakeCase(sf.Name), false
+}
+
+func snakeCase(name string) string {
+	var sb strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func (si *structInfo) lookup(column string) (*fieldInfo, bool) {
+	field, hit := si.fields[strings.ToLower(column)]
+	return field, hit
+}
+
+func (si *structInfo) check(columns []string) error {
+	err := &MapError{Type: si.typ.String()}
+	got := map[string]bool{}
+	for _, col := range columns {
+		got[strings.ToLower(col)] = true
+		if _, hit := si.lookup(col); !hit {
+			err.Unmapped = append(err.Unmapped, col)
+		}
+	}
+	for key, field := range si.fields {
+		if field.required && !got[key] {
+			err.Missing = append(err.Missing, field.column)
+		}
+	}
+	if len(err.Unmapped) == 0 && len(err.Missing) == 0 {
+		return nil
+	}
+	sort.Strings(err.Unmapped)
+	sort.Strings(err.Missing)
+	return err
+}
+
+// fieldByIndex 同reflect.FieldByIndex，但会初始化内嵌的空指针
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+	return v
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+)
+
+func isScannable(typ reflect.Type) bool {
+	return typ.Implements(scannerType) || reflect.PointerTo(typ).Implements(scannerType)
+}
+
+// assignValue 将驱动返回的原始值赋给字段
+func assignValue(dst reflect.Value, raw any) error {
+	if raw == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		if str, ok := scanStr(raw); ok {
+			return dst.Addr().Interface().(sql.Scanner).Scan(str)
+		}
+		return dst.Addr().Interface().(sql.Scanner).Scan(raw)
+	}
+	rv := reflect.ValueOf(raw)
+	if rv.Type().AssignableTo(dst.Type()) {
+		dst.Set(rv)
+		return nil
+	}
+	if valuer, ok := raw.(driver.Valuer); ok && rv.Type() != timeType {
+		val, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		return assignValue(dst, val)
+	}
+	if b, ok := raw.([]byte); ok && dst.Type() != bytesType {
+		raw, rv = string(b), reflect.ValueOf(string(b))
+	}
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(fmt.Sprint(raw))
+		return nil
+	case reflect.Bool:
+		b, err := toBool(rv)
+		if err == nil {
+			dst.SetBool(b)
+		}
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt(rv)
+		if err == nil {
+			dst.SetInt(i)
+		}
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := toInt(rv)
+		if err == nil {
+			dst.SetUint(uint64(i))
+		}
+		return err
+
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(rv)
+		if err == nil {
+			dst.SetFloat(f)
+		}
+		return err
+	}
+	if dst.Type() == timeType && rv.Kind() == reflect.String {
+		dst.Set(reflect.ValueOf(jsonx.AsTime(rv.String())))
+		return nil
+	}
+	if rv.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(rv.Convert(dst.Type()))
+		return nil
+	}
+	// 兜底: 以json中转(结构体/切片/映射等)
+	data := []byte(nil)
+	if str, ok := raw.(string); ok {
+		data = []byte(str)
+	} else {
+		var err error
+		if data, err = jsonx.Marshal(raw); err != nil {
+			return err
+		}
+	}
+	return jsonx.Unmarshal(data, dst.Addr().Interface())
+}
+
+func toInt(rv reflect.Value) (int64, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.String:
+		if i, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	f, err := toFloat(rv)
+	return int64(f), err
+}
+
+func toFloat(rv reflect.Value) (float64, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		return strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+	}
+	return 0, fmt.Errorf("can not convert %v to number", rv.Type())
+}
+
+func toBool(rv reflect.Value) (bool, error) {
+	if rv.Kind() == reflect.String {
+		return strconv.ParseBool(strings.TrimSpace(rv.String()))
+	}
+	f, err := toFloat(rv)
+	return f != 0, err
+}
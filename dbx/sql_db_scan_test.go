@@ -0,0 +1,130 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQuery 按顺序返回预置结果的IQuery
+type fakeQuery struct {
+	d     Dialect
+	rows  []*jsonx.JObj
+	execs []string
+	args  [][]any
+	fail  error
+}
+
+func (f *fakeQuery) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	f.execs = append(f.execs, query)
+	f.args = append(f.args, args)
+	if f.fail != nil {
+		return nil, f.fail
+	}
+	return f.rows, nil
+}
+
+func (f *fakeQuery) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	f.execs = append(f.execs, query)
+	f.args = append(f.args, args)
+	if f.fail != nil {
+		return f.fail
+	}
+	for _, row := range f.rows {
+		if err := eachRow(ctx, fn, row); err != nil {
+			return stopOrErr(err)
+		}
+	}
+	return nil
+}
+
+func (f *fakeQuery) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	f.execs = append(f.execs, query)
+	f.args = append(f.args, args)
+	if f.fail != nil {
+		return ExecResult{}, f.fail
+	}
+	return ExecResult{RowsAffected: 1}, nil
+}
+
+func (f *fakeQuery) Dialect() Dialect {
+	return gox.IfElse(f.d == "", DialectPostgres, f.d).(Dialect)
+}
+
+type scanUser struct {
+	Obj
+	Name    string    `db:"name"`
+	Age     int       `json:"age"`
+	Score   *float64  `json:"score"`
+	Tags    StrArr    `json:"tags"`
+	Ids     LongArr   `json:"ids"`
+	Props   MapI2S    `json:"props"`
+	Active  bool      `json:"active"`
+	LoginAt time.Time `json:"login_at"`
+	Nick    string
+}
+
+func TestQueryAs(t *testing.T) {
+	oid := NewOID()
+	now := time.Now().Truncate(time.Second)
+	db := &fakeQuery{rows: []*jsonx.JObj{
+		{
+			"id":        oid.Hex(),
+			"name":      []byte("tom"),
+			"age":       int32(18),
+			"score":     "9.5",
+			"tags":      []byte(`["a","b"]`),
+			"ids":       []any{int64(1), int64(2)},
+			"props":     map[string]any{"k": "v"},
+			"active":    int64(1),
+			"login_at":  now,
+			"ext_attrs": `{"x":1}`,
+			"nick":      nil,
+		},
+	}}
+	users, err := QueryAs[scanUser](context.Background(), db, "select * from users")
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	u := users[0]
+	assert.Equal(t, oid.Hex(), u.ID.Hex())
+	assert.Equal(t, "tom", u.Name)
+	assert.Equal(t, 18, u.Age)
+	assert.Equal(t, 9.5, *u.Score)
+	assert.Equal(t, StrArr{"a", "b"}, u.Tags)
+	assert.Equal(t, LongArr{1, 2}, u.Ids)
+	assert.Equal(t, MapI2S{"k": "v"}, u.Props)
+	assert.True(t, u.Active)
+	assert.Equal(t, now, u.LoginAt)
+	assert.Equal(t, int64(1), u.ExtAttrs.GetLong("x"))
+	assert.Equal(t, "", u.Nick)
+
+	ptrs, err := QueryAs[*scanUser](context.Background(), db, "select * from users")
+	assert.NoError(t, err)
+	assert.Equal(t, "tom", ptrs[0].Name)
+}
+
+func TestQueryAsMapError(t *testing.T) {
+	db := &fakeQuery{rows: []*jsonx.JObj{{"age": 1, "unknown": 2}}}
+	_, err := QueryAs[scanUser](context.Background(), db, "select age, unknown from users")
+	var mapErr *MapError
+	assert.True(t, errors.As(err, &mapErr))
+	assert.Equal(t, []string{"unknown"}, mapErr.Unmapped)
+	assert.Equal(t, []string{"name"}, mapErr.Missing)
+}
+
+func TestQueryOne(t *testing.T) {
+	db := &fakeQuery{}
+	_, err := QueryOne[scanUser](context.Background(), db, "select * from users")
+	assert.ErrorIs(t, err, ErrNoRows)
+
+	db.rows = []*jsonx.JObj{{"name": "a"}, {"name": "b"}}
+	u, err := QueryOne[scanUser](context.Background(), db, "select name from users")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", u.Name)
+}
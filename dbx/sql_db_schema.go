@@ -0,0 +1,293 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ISchema 表结构查询，基于information_schema(MySQL/Doris)、pg_catalog(PostgreSQL)或pragma(SQLite)
+type ISchema interface {
+	// Tables 当前库(schema)下的表与视图
+	Tables(ctx context.Context) ([]Table, error)
+	// Columns 表的列，按定义顺序
+	Columns(ctx context.Context, table string) ([]Column, error)
+	// Indexes 表的索引，Doris返回建表的Key列
+	Indexes(ctx context.Context, table string) ([]Index, error)
+	// PrimaryKey 主键列，按键顺序；无主键时为空
+	PrimaryKey(ctx context.Context, table string) ([]string, error)
+}
+
+// 归一化列类型
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeDecimal  = "decimal"
+	TypeBool     = "bool"
+	TypeDate     = "date"
+	TypeTime     = "time"
+	TypeDateTime = "datetime"
+	TypeJSON     = "json"
+	TypeBytes    = "bytes"
+	TypeArray    = "array"
+	TypeOther    = "other"
+)
+
+// Table 表信息
+type Table struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+}
+
+// Column 列信息
+type Column struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`    // 归一化类型，见TypeString等
+	DBType     string `json:"db_type"` // 数据库原始类型，如varchar(64)
+	Nullable   bool   `json:"nullable"`
+	Default    string `json:"default_value"`
+	AutoIncr   bool   `json:"auto_incr"`
+	PrimaryKey bool   `json:"is_pk"`
+	Comment    string `json:"comment"`
+	Position   int    `json:"position"`
+}
+
+// Index 索引信息
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Primary bool
+}
+
+// NormalizeType 将数据库原始类型归一化为TypeString/TypeInt等
+func NormalizeType(dbType string) string {
+	t := strings.ToLower(strings.TrimSpace(dbType))
+	if strings.HasSuffix(t, "[]") || strings.HasPrefix(t, "array") {
+		return TypeArray
+	}
+	// MySQL惯例: tinyint(1)表示布尔
+	if strings.HasPrefix(t, "tinyint(1)") {
+		return TypeBool
+	}
+	if i := strings.IndexAny(t, "(<"); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	t = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(t, " zerofill"), " unsigned"))
+	switch {
+	case strings.HasPrefix(t, "timestamp"), strings.HasPrefix(t, "datetime"):
+		return TypeDateTime
+	case t == "date" || t == "datev2":
+		return TypeDate
+	case strings.HasPrefix(t, "time"):
+		return TypeTime
+	case strings.HasPrefix(t, "character"), strings.HasPrefix(t, "varchar"), strings.HasPrefix(t, "nvarchar"):
+		return TypeString
+	}
+	switch t {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "largeint",
+		"int2", "int4", "int8", "serial", "smallserial", "bigserial", "serial4", "serial8":
+		return TypeInt
+	case "bool", "boolean":
+		return TypeBool
+	case "float", "double", "real", "float4", "float8", "double precision":
+		return TypeFloat
+	case "decimal", "numeric", "money", "decimalv3":
+		return TypeDecimal
+	case "char", "text", "tinytext", "mediumtext", "longtext", "string", "uuid", "enum", "set", "citext", "name", "bpchar", "clob":
+		return TypeString
+	case "json", "jsonb", "variant":
+		return TypeJSON
+	case "blob", "tinyblob", "mediumblob", "longblob", "bytea", "binary", "varbinary":
+		return TypeBytes
+	}
+	return TypeOther
+}
+
+// splitTable 拆分schema.table
+func splitTable(table string) (schema, name string, err error) {
+	if !IsIdent(table) {
+		return "", "", fmt.Errorf("dbx: bad table name %q", table)
+	}
+	if i := strings.Index(table, "."); i >= 0 {
+		return table[:i], table[i+1:], nil
+	}
+	return "", table, nil
+}
+
+// schemaOf 未指定schema时为nil，由SQL取当前库
+func schemaOf(schema string) any {
+	if schema == "" {
+		return nil
+	}
+	return schema
+}
+
+// schemaTables 按方言查询表
+func schemaTables(ctx context.Context, q IQuery) ([]Table, error) {
+	var query string
+	switch q.Dialect() {
+	case DialectPostgres:
+		query = `SELECT c.relname AS name, COALESCE(obj_description(c.oid, 'pg_class'), '') AS comment
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p', 'v') ORDER BY c.relname`
+	case DialectSQLite:
+		query = `SELECT name, '' AS comment FROM sqlite_master
+WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`
+	default:
+		query = `SELECT table_name AS name, table_comment AS comment FROM information_schema.tables
+WHERE table_schema = DATABASE() ORDER BY table_name`
+	}
+	return QueryAs[Table](ctx, q, query)
+}
+
+// schemaColumns 按方言查询列
+func schemaColumns(ctx context.Context, q IQuery, table string) ([]Column, error) {
+	schema, name, err := splitTable(table)
+	if err != nil {
+		return nil, err
+	}
+	var query string
+	var args []any
+	switch q.Dialect() {
+	case DialectPostgres:
+		query = `SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS db_type, NOT a.attnotnull AS nullable,
+	COALESCE(pg_get_expr(d.adbin, d.adrelid), '') AS default_value,
+	a.attidentity IN ('a', 'd') OR COALESCE(pg_get_expr(d.adbin, d.adrelid), '') LIKE 'nextval(%' AS auto_incr,
+	COALESCE(a.attnum = ANY(pk.indkey), false) AS is_pk, COALESCE(col_description(a.attrelid, a.attnum), '') AS comment,
+	a.attnum AS position
+FROM pg_attribute a
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+LEFT JOIN pg_index pk ON pk.indrelid = a.attrelid AND pk.indisprimary
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum`
+		args = []any{DialectPostgres.Quote(table)}
+	case DialectSQLite:
+		query = `SELECT name, type AS db_type, "notnull" = 0 AND pk = 0 AS nullable, COALESCE(dflt_value, '') AS default_value,
+	pk > 0 AND lower(type) = 'integer' AS auto_incr, pk > 0 AS is_pk, '' AS comment, cid + 1 AS position
+FROM pragma_table_info(?) ORDER BY cid`
+		args = []any{name}
+	case DialectDoris:
+		query = `SELECT column_name AS name, column_type AS db_type, is_nullable = 'YES' AS nullable,
+	COALESCE(column_default, '') AS default_value, false AS auto_incr, column_key = 'UNI' AS is_pk,
+	column_comment AS comment, ordinal_position AS position
+FROM information_schema.columns WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? ORDER BY ordinal_position`
+		args = []any{schemaOf(schema), name}
+	default:
+		query = `SELECT column_name AS name, column_type AS db_type, is_nullable = 'YES' AS nullable,
+	COALESCE(column_default, '') AS default_value, extra LIKE '%auto_increment%' AS auto_incr, column_key = 'PRI' AS is_pk,
+	column_comment AS comment, ordinal_position AS position
+FROM information_schema.columns WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? ORDER BY ordinal_position`
+		args = []any{schemaOf(schema), name}
+	}
+	columns, err := QueryAs[Column](ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("dbx: table %v not found", table)
+	}
+	for i := range columns {
+		columns[i].Type = NormalizeType(columns[i].DBType)
+	}
+	return columns, nil
+}
+
+type indexRow struct {
+	Name    string `json:"name"`
+	Unique  bool   `json:"is_unique"`
+	Primary bool   `json:"is_primary"`
+	Column  string `json:"column_name"`
+}
+
+// schemaIndexes 按方言查询索引，每行一个索引列，按索引名聚合
+func schemaIndexes(ctx context.Context, q IQuery, table string) ([]Index, error) {
+	schema, name, err := splitTable(table)
+	if err != nil {
+		return nil, err
+	}
+	var query string
+	var args []any
+	switch q.Dialect() {
+	case DialectPostgres:
+		query = `SELECT i.relname AS name, ix.indisunique AS is_unique, ix.indisprimary AS is_primary, a.attname AS column_name
+FROM pg_index ix
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum
+WHERE ix.indrelid = $1::regclass ORDER BY i.relname, k.ord`
+		args = []any{DialectPostgres.Quote(table)}
+	case DialectSQLite:
+		query = `SELECT il.name AS name, il."unique" AS is_unique, il.origin = 'pk' AS is_primary, ii.name AS column_name
+FROM pragma_index_list(?) il JOIN pragma_index_info(il.name) ii ORDER BY il.name, ii.seqno`
+		args = []any{name}
+	case DialectDoris:
+		// Doris无二级索引元数据，以建表的Key列作为索引
+		columns, err := schemaColumns(ctx, q, table)
+		if err != nil {
+			return nil, err
+		}
+		keys := keyColumns(columns)
+		if len(keys) == 0 {
+			return []Index{}, nil
+		}
+		return []Index{{Name: "PRIMARY", Columns: keys, Unique: true, Primary: true}}, nil
+	default:
+		query = `SELECT index_name AS name, non_unique = 0 AS is_unique, index_name = 'PRIMARY' AS is_primary, column_name AS column_name
+FROM information_schema.statistics WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ? ORDER BY index_name, seq_in_index`
+		args = []any{schemaOf(schema), name}
+	}
+	rows, err := QueryAs[indexRow](ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]Index, 0)
+	for _, row := range rows {
+		if n := len(indexes); n > 0 && indexes[n-1].Name == row.Name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, row.Column)
+			continue
+		}
+		indexes = append(indexes, Index{Name: row.Name, Columns: []string{row.Column}, Unique: row.Unique, Primary: row.Primary})
+	}
+	return indexes, nil
+}
+
+// schemaPrimaryKey 主键列：优先取主键索引，SQLite的INTEGER PRIMARY KEY没有索引时取列定义
+func schemaPrimaryKey(ctx context.Context, q IQuery, table string) ([]string, error) {
+	if q.Dialect() == DialectSQLite {
+		_, name, err := splitTable(table)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := q.Query(ctx, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", name)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, len(rows))
+		for i, row := range rows {
+			keys[i] = row.GetStr("name")
+		}
+		return keys, nil
+	}
+	indexes, err := schemaIndexes(ctx, q, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if index.Primary {
+			return index.Columns, nil
+		}
+	}
+	return []string{}, nil
+}
+
+// keyColumns 主键列，按列顺序
+func keyColumns(columns []Column) []string {
+	keys := make([]string, 0)
+	for _, col := range columns {
+		if col.PrimaryKey {
+			keys = append(keys, col.Name)
+		}
+	}
+	return keys
+}
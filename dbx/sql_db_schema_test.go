@@ -0,0 +1,92 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeType(t *testing.T) {
+	cases := map[string]string{
+		"int(11) unsigned":            TypeInt,
+		"bigserial":                   TypeInt,
+		"tinyint(1)":                  TypeBool,
+		"character varying(64)":       TypeString,
+		"varchar(255)":                TypeString,
+		"numeric(10,2)":               TypeDecimal,
+		"double precision":            TypeFloat,
+		"timestamp without time zone": TypeDateTime,
+		"datetimev2(3)":               TypeDateTime,
+		"date":                        TypeDate,
+		"time(6)":                     TypeTime,
+		"jsonb":                       TypeJSON,
+		"bytea":                       TypeBytes,
+		"integer[]":                   TypeArray,
+		"ARRAY<INT>":                  TypeArray,
+		"interval":                    TypeOther,
+	}
+	for dbType, want := range cases {
+		assert.Equal(t, want, NormalizeType(dbType), dbType)
+	}
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	ctx := context.Background()
+	db := NewSQLite("local", &jsonx.JObj{"db_url": "sqlite://:memory:"})
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, `CREATE TABLE orders (
+		id INTEGER PRIMARY KEY,
+		no VARCHAR(32) NOT NULL,
+		amount DECIMAL(10,2),
+		paid BOOLEAN DEFAULT 0,
+		created_at DATETIME NOT NULL
+	)`)
+	assert.NoError(t, err)
+	_, err = db.Exec(ctx, "CREATE UNIQUE INDEX uk_orders_no ON orders (no, created_at)")
+	assert.NoError(t, err)
+
+	tables, err := db.Tables(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Table{{Name: "orders"}}, tables)
+
+	columns, err := db.Columns(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Len(t, columns, 5)
+	assert.Equal(t, Column{Name: "id", Type: TypeInt, DBType: "INTEGER", AutoIncr: true, PrimaryKey: true, Position: 1}, columns[0])
+	assert.Equal(t, TypeString, columns[1].Type)
+	assert.False(t, columns[1].Nullable)
+	assert.Equal(t, TypeDecimal, columns[2].Type)
+	assert.True(t, columns[2].Nullable)
+	assert.Equal(t, "0", columns[3].Default)
+	assert.Equal(t, TypeDateTime, columns[4].Type)
+
+	indexes, err := db.Indexes(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, []Index{{Name: "uk_orders_no", Columns: []string{"no", "created_at"}, Unique: true}}, indexes)
+
+	pk, err := db.PrimaryKey(ctx, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id"}, pk)
+
+	_, err = db.Columns(ctx, "missing")
+	assert.Error(t, err)
+	_, err = db.Columns(ctx, "orders;drop")
+	assert.Error(t, err)
+}
+
+func TestMySQLSchema(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeSQL{fakeQuery: &fakeQuery{d: DialectMySQL, rows: []*jsonx.JObj{
+		{"name": "PRIMARY", "is_unique": int64(1), "is_primary": int64(1), "column_name": "tenant_id"},
+		{"name": "PRIMARY", "is_unique": int64(1), "is_primary": int64(1), "column_name": "id"},
+		{"name": "idx_name", "is_unique": int64(0), "is_primary": int64(0), "column_name": "name"},
+	}}}
+	pk, err := db.PrimaryKey(ctx, "app.users")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant_id", "id"}, pk)
+	assert.Contains(t, db.execs[0], "information_schema.statistics")
+	assert.Equal(t, []any{"app", "users"}, db.args[0])
+}
@@ -0,0 +1,235 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite 嵌入式数据库（纯Go驱动），用于本地开发、测试与单文件工具
+type SQLite struct {
+	name   string
+	conf   DBConf
+	db     *sql.DB
+	dbType string
+	lock   sync.Mutex
+	single chan struct{} // 内存库唯一连接的令牌，nil表示不限制
+}
+
+// NewSQLite 创建SQLite数据库实例
+func NewSQLite(name string, conf DBConf) ISQL {
+	return &SQLite{
+		name:   name,
+		conf:   conf,
+		dbType: "SQLite",
+	}
+}
+
+// Connect 打开数据库文件
+func (s *SQLite) Connect(ctx context.Context) error {
+	connStr := s.ConnString(s.conf)
+	db, err := sql.Open("sqlite", connStr)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	tunePool(db, s.conf)
+	// 每个连接各自持有一个内存库，内存库只能使用单连接
+	if isMemoryDSN(connStr) {
+		db.SetMaxOpenConns(1)
+		db.SetConnMaxIdleTime(0)
+		db.SetConnMaxLifetime(0)
+		s.single = make(chan struct{}, 1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	s.db = db
+	return nil
+}
+
+// ConnString 构建SQLite连接字符串: sqlite://path/to/file.db、sqlite://:memory: 或配置path
+func (s *SQLite) ConnString(conf DBConf) string {
+	dsn := getInOrder(conf, "db_url", "url", "path", "file")
+	if dsn == "" {
+		dsn = ":memory:"
+	}
+	if strings.HasPrefix(strings.ToLower(dsn), "sqlite://") {
+		dsn = dsn[len("sqlite://"):]
+	}
+	// 默认开启外键并设置忙等待，避免并发写立即返回SQLITE_BUSY
+	if !strings.Contains(dsn, "_pragma=") {
+		dsn += gox.IfElse(strings.Contains(dsn, "?"), "&", "?").(string) + "_pragma=foreign_keys(1)&_pragma=busy_timeout(" + getOrDefault(conf, "busy_timeout_ms", "5000") + ")"
+	}
+	return dsn
+}
+
+// isMemoryDSN 是否为内存库，含file::memory:与file::memory:?cache=shared等URI形式
+func isMemoryDSN(dsn string) bool {
+	return strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// ensure 懒连接
+func (s *SQLite) ensure(ctx context.Context) error {
+	if s.db == nil {
+		if err := s.Connect(ctx); err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+	}
+	return nil
+}
+
+// acquire 占用内存库的唯一连接；等待busy_timeout_ms(默认5000)仍被占用时返回错误，
+// 避免在QueryEach回调内或事务未结束时在事务外执行语句而永久等待自身
+func (s *SQLite) acquire(ctx context.Context) (func(), error) {
+	if s.single == nil {
+		return func() {}, nil
+	}
+	timeout := time.Duration(getIntOr(s.conf, "busy_timeout_ms", 5000)) * time.Millisecond
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case s.single <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-s.single }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("%v :memory: connection busy for %v, nested statement in QueryEach or outside an open transaction?", s.dbType, timeout)
+	}
+}
+
+// Query 执行SQLite查询
+func (s *SQLite) Query(ctx context.Context, query string, args ...any) ([]*jsonx.JObj, error) {
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return sqlQuery(ctx, s.db, s.dbType, query, args...)
+}
+
+// QueryEach 流式执行SQLite查询
+func (s *SQLite) QueryEach(ctx context.Context, query string, args []any, fn func(row *jsonx.JObj) error) error {
+	if err := s.ensure(ctx); err != nil {
+		return err
+	}
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return sqlQueryEach(ctx, s.db, s.dbType, query, args, fn)
+}
+
+// Exec 执行SQLite写操作
+func (s *SQLite) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	if err := s.ensure(ctx); err != nil {
+		return ExecResult{}, err
+	}
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	defer release()
+	return sqlExec(ctx, s.db, s.dbType, query, args...)
+}
+
+// Dialect SQLite方言
+func (s *SQLite) Dialect() Dialect {
+	return DialectSQLite
+}
+
+// Begin 开启事务
+func (s *SQLite) Begin(ctx context.Context) (ITx, error) {
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("%v begin error: %w", s.dbType, err)
+	}
+	return &sqliteTx{MTx: &MTx{tx: tx, dbType: s.dbType}, release: release}, nil
+}
+
+// sqliteTx 结束时归还内存库连接的事务
+type sqliteTx struct {
+	*MTx
+	release func()
+}
+
+// Commit 提交事务
+func (t *sqliteTx) Commit(ctx context.Context) error {
+	defer t.release()
+	return t.MTx.Commit(ctx)
+}
+
+// Rollback 回滚事务
+func (t *sqliteTx) Rollback(ctx context.Context) error {
+	defer t.release()
+	return t.MTx.Rollback(ctx)
+}
+
+// BulkInsert 批量写入：多行INSERT，冲突策略使用ON CONFLICT
+func (s *SQLite) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	if err := checkBulk(table, columns); err != nil {
+		return 0, err
+	}
+	if err := s.ensure(ctx); err != nil {
+		return 0, err
+	}
+	return sqlBulkInsert(ctx, s, table, columns, rows, newBulkConf(opts))
+}
+
+// Tables 数据库的表与视图
+func (s *SQLite) Tables(ctx context.Context) ([]Table, error) {
+	return schemaTables(ctx, s)
+}
+
+// Columns 表的列
+func (s *SQLite) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, s, table)
+}
+
+// Indexes 表的索引
+func (s *SQLite) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, s, table)
+}
+
+// PrimaryKey 表的主键列
+func (s *SQLite) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, s, table)
+}
+
+// withLock SQLite无会话锁，同一实例内以互斥锁串行
+func (s *SQLite) withLock(ctx context.Context, key string, fn func() error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return fn()
+}
+
+// Close 关闭数据库
+func (s *SQLite) Close(ctx context.Context) error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
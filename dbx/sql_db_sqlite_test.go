@@ -0,0 +1,122 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLite(t *testing.T) {
+	ctx := context.Background()
+	dm := &DBMgr{dbMap: map[string]ISQL{}, confMap: map[string]DBConf{}}
+	err := dm.Init(ctx, map[string]DBConf{"local": &jsonx.JObj{"db_url": "sqlite://:memory:"}})
+	assert.NoError(t, err)
+	defer dm.CloseAll(ctx)
+	db, err := dm.Use("local")
+	assert.NoError(t, err)
+	assert.Equal(t, DialectSQLite, db.Dialect())
+
+	_, err = db.Exec(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, avatar BLOB)")
+	assert.NoError(t, err)
+	res, err := db.Exec(ctx, "INSERT INTO users (name, score) VALUES (?, ?)", "tom", 9.5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.LastInsertId)
+
+	n, err := db.BulkInsert(ctx, "users", []string{"id", "name"}, [][]any{{1, "jerry"}, {2, "spike"}},
+		WithConflict(ConflictUpdate, "id"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	err = WithTx(ctx, db, func(tx ITx) error {
+		_, err := Update("users").Set("score", 1).Where(jsonx.JObj{"id": 2}).Exec(ctx, tx)
+		return err
+	})
+	assert.NoError(t, err)
+
+	rows, err := Select("users").OrderBy("id").Query(ctx, db)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "jerry", rows[0].GetStr("name"))
+	assert.Equal(t, 9.5, rows[0].GetDouble("score"))
+	assert.Equal(t, int64(1), rows[1].GetLong("score"))
+
+	type user struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	u, err := QueryOne[user](ctx, db, "SELECT id, name FROM users WHERE id = ?", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "spike", u.Name)
+
+	m, err := dm.Migrator("local", fstest.MapFS{
+		"1_tags.up.sql":   {Data: []byte("CREATE TABLE tags (id INTEGER PRIMARY KEY);\nINSERT INTO tags VALUES (1);")},
+		"1_tags.down.sql": {Data: []byte("DROP TABLE tags;")},
+	})
+	assert.NoError(t, err)
+	applied, err := m.Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	status, err := m.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[0].AppliedAt.IsZero())
+	applied, err = m.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	_, err = db.Query(ctx, "SELECT * FROM tags")
+	assert.Error(t, err)
+}
+
+func TestSQLiteMemoryBusy(t *testing.T) {
+	ctx := context.Background()
+	db := NewSQLite("mem", &jsonx.JObj{"db_url": "sqlite://:memory:", "busy_timeout_ms": 50})
+	assert.NoError(t, db.Connect(ctx))
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+	assert.NoError(t, err)
+	_, err = db.Exec(ctx, "INSERT INTO t VALUES (1)")
+	assert.NoError(t, err)
+
+	// 内存库只有一个连接，回调内再查询返回错误而不是死锁
+	err = db.QueryEach(ctx, "SELECT id FROM t", nil, func(row *jsonx.JObj) error {
+		_, err := db.Query(ctx, "SELECT 1")
+		return err
+	})
+	assert.ErrorContains(t, err, "connection busy")
+
+	// 事务未结束时在事务外执行语句同样返回错误，事务结束后恢复
+	tx, err := db.Begin(ctx)
+	assert.NoError(t, err)
+	_, err = db.Exec(ctx, "INSERT INTO t VALUES (2)")
+	assert.ErrorContains(t, err, "connection busy")
+	assert.NoError(t, tx.Commit(ctx))
+	assert.Error(t, tx.Rollback(ctx)) // 已提交，不重复归还
+	_, err = db.Exec(ctx, "INSERT INTO t VALUES (2)")
+	assert.NoError(t, err)
+}
+
+func TestSQLiteMemoryDSN(t *testing.T) {
+	ctx := context.Background()
+	for _, dsn := range []string{":memory:", "file::memory:", "file::memory:?cache=shared", "file:mem?mode=memory"} {
+		assert.True(t, isMemoryDSN(dsn), dsn)
+	}
+	assert.False(t, isMemoryDSN("data/app.db"))
+
+	// URI形式的内存库同样只用一个连接：回调内嵌套查询报连接占用，而不是在另一个空库上找不到表
+	db := NewSQLite("uri", &jsonx.JObj{"db_url": "sqlite://file::memory:", "busy_timeout_ms": 50})
+	assert.NoError(t, db.Connect(ctx))
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+	assert.NoError(t, err)
+	_, err = db.Exec(ctx, "INSERT INTO t VALUES (1)")
+	assert.NoError(t, err)
+	err = db.QueryEach(ctx, "SELECT id FROM t", nil, func(row *jsonx.JObj) error {
+		_, err := db.Query(ctx, "SELECT id FROM t")
+		return err
+	})
+	assert.ErrorContains(t, err, "connection busy")
+}
@@ -0,0 +1,100 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"iter"
+	"reflect"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// ErrStopEach QueryEach回调返回该错误时提前结束遍历，QueryEach返回nil
+var ErrStopEach = errors.New("dbx: stop each")
+
+// eachRow 检查上下文后回调
+func eachRow(ctx context.Context, fn func(row *jsonx.JObj) error, row *jsonx.JObj) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(row)
+}
+
+// stopOrErr 将ErrStopEach转换为正常结束
+func stopOrErr(err error) error {
+	if errors.Is(err, ErrStopEach) {
+		return nil
+	}
+	return err
+}
+
+// Rows 以迭代器形式流式查询，break即提前结束
+//
+//	for row, err := range dbx.Rows(ctx, db, "SELECT * FROM t") {
+//		if err != nil { ... }
+//	}
+func Rows(ctx context.Context, db IQuery, query string, args ...any) iter.Seq2[*jsonx.JObj, error] {
+	return func(yield func(*jsonx.JObj, error) bool) {
+		err := db.QueryEach(ctx, query, args, func(row *jsonx.JObj) error {
+			if !yield(row, nil) {
+				return ErrStopEach
+			}
+			return nil
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// QueryEachAs 流式查询并将每行映射为T，首行校验列映射
+func QueryEachAs[T any](ctx context.Context, db IQuery, query string, args []any, fn func(item T) error) error {
+	info, err := structInfoOf(reflect.TypeOf(*new(T)))
+	if err != nil {
+		return err
+	}
+	checked := false
+	return db.QueryEach(ctx, query, args, func(row *jsonx.JObj) error {
+		if !checked {
+			if err := info.check(row.Keys()); err != nil {
+				return err
+			}
+			checked = true
+		}
+		item, err := rowAs[T](info, row)
+		if err != nil {
+			return err
+		}
+		return fn(item)
+	})
+}
+
+// CsvEach 返回将行按columns顺序追加到csv的回调，用于QueryEach导出
+func CsvEach(csv *gox.Csvx, columns []string) func(row *jsonx.JObj) error {
+	return func(row *jsonx.JObj) error {
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			cells[i] = cellOf((*row)[col])
+		}
+		return csv.Append(cells)
+	}
+}
+
+// cellOf 驱动原始值转为单元格文本
+func cellOf(raw any) string {
+	switch v := raw.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case driver.Valuer:
+		if val, err := v.Value(); err == nil {
+			return cellOf(val)
+		}
+		return ""
+	default:
+		return jsonx.GoV2JV(v).String()
+	}
+}
@@ -0,0 +1,99 @@
+package dbx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowsEarlyStop(t *testing.T) {
+	db := &fakeQuery{rows: []*jsonx.JObj{{"name": "a"}, {"name": "b"}, {"name": "c"}}}
+	names := make([]string, 0)
+	for row, err := range Rows(context.Background(), db, "select name from t") {
+		assert.NoError(t, err)
+		names = append(names, row.GetStr("name"))
+		if len(names) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+}
+
+func TestQueryEachCancel(t *testing.T) {
+	db := &fakeQuery{rows: []*jsonx.JObj{{"name": "a"}, {"name": "b"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err := db.QueryEach(ctx, "select name from t", nil, func(row *jsonx.JObj) error {
+		count++
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, count)
+}
+
+func TestSQLiteStream(t *testing.T) {
+	ctx := context.Background()
+	db := NewSQLite("stream", &jsonx.JObj{"db_url": "sqlite://:memory:"})
+	assert.NoError(t, db.Connect(ctx))
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, "CREATE TABLE t (name TEXT)")
+	assert.NoError(t, err)
+	_, err = db.Exec(ctx, "INSERT INTO t VALUES ('a'), ('b'), ('c')")
+	assert.NoError(t, err)
+
+	// break提前结束，连接归还后可继续使用
+	names := make([]string, 0)
+	for row, err := range Rows(ctx, db, "SELECT name FROM t ORDER BY name") {
+		assert.NoError(t, err)
+		names = append(names, row.GetStr("name"))
+		if len(names) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+	count := 0
+	assert.NoError(t, db.QueryEach(ctx, "SELECT name FROM t", nil, func(row *jsonx.JObj) error {
+		count++
+		return ErrStopEach
+	}))
+	assert.Equal(t, 1, count)
+
+	// 遍历中取消
+	cctx, cancel := context.WithCancel(ctx)
+	count = 0
+	err = db.QueryEach(cctx, "SELECT name FROM t", nil, func(row *jsonx.JObj) error {
+		count++
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, count)
+	rows, err := db.Query(ctx, "SELECT COUNT(*) AS n FROM t")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rows[0].GetLong("n"))
+}
+
+func TestQueryEachAsCsv(t *testing.T) {
+	db := &fakeQuery{rows: []*jsonx.JObj{{"name": []byte("a"), "age": int64(1)}, {"name": "b", "age": nil}}}
+	ages := make([]int, 0)
+	err := QueryEachAs(context.Background(), db, "select * from t", nil, func(u scanUser) error {
+		ages = append(ages, u.Age)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 0}, ages)
+
+	file := filepath.Join(t.TempDir(), "out.csv")
+	csv, err := gox.NewCsv(context.Background(), file, []string{"name", "age"})
+	assert.NoError(t, err)
+	assert.NoError(t, db.QueryEach(context.Background(), "select * from t", nil, CsvEach(csv, []string{"name", "age"})))
+	data, _ := os.ReadFile(file)
+	assert.Equal(t, "'name','age'\n'a','1'\n'b',''\n", string(data))
+}
@@ -0,0 +1,86 @@
+package dbx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Dialect SQL方言，决定占位符、标识符引用与upsert语法
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgresql"
+	DialectMySQL    Dialect = "mysql"
+	DialectDoris    Dialect = "doris"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// DialectOf 由db_type(或dbType)解析方言，未知类型按MySQL处理
+func DialectOf(dbType string) Dialect {
+	switch strings.ToLower(dbType) {
+	case "postgresql", "postgres", "pg":
+		return DialectPostgres
+	case "doris":
+		return DialectDoris
+	case "sqlite", "sqlite3":
+		return DialectSQLite
+	default:
+		return DialectMySQL
+	}
+}
+
+// Placeholder 第n(从1开始)个参数的占位符
+func (d Dialect) Placeholder(n int) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// Quote 引用标识符，支持schema.table形式
+func (d Dialect) Quote(ident string) string {
+	quote := "`"
+	if d == DialectPostgres || d == DialectSQLite {
+		quote = `"`
+	}
+	parts := strings.Split(ident, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+var identRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// IsIdent 是否为安全标识符(字母/数字/下划线，可带一级schema)
+func IsIdent(name string) bool {
+	return identRegex.MatchString(name)
+}
+
+// Rebind 将?占位符改写为方言占位符，跳过引号内内容；start为已有参数个数
+func (d Dialect) Rebind(query string, start int) string {
+	if d != DialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var sb strings.Builder
+	var quote byte
+	n := start
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			sb.WriteString(d.Placeholder(n))
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
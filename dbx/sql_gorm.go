@@ -0,0 +1,433 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Gorm 按名称获取*gorm.DB，首次调用时基于已建立的连接池创建；读写分离时使用主库。
+// gorm的语句不经过dbx的拦截器与重试。
+// 配置gorm_log(silent/error/warn/info，默认warn)与slow_ms控制gorm日志
+func (dm *DBMgr) Gorm(name string) (*gorm.DB, error) {
+	dm.mutex.RLock()
+	g, ok := dm.gormMap[name]
+	db, found := dm.dbMap[name]
+	conf := dm.confMap[name]
+	dm.mutex.RUnlock()
+	if ok {
+		return g, nil
+	}
+	if !found {
+		return nil, fmt.Errorf("database %s not found", name)
+	}
+	// gorm.Open会ping并查询版本，不持有锁，避免网络阻塞其他库的Use
+	g, err := openGorm(db, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gorm for %s: %v", name, err)
+	}
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	// 并发创建时以先写入者为准
+	if existing, ok := dm.gormMap[name]; ok {
+		closeGorm(g)
+		return existing, nil
+	}
+	if dm.gormMap == nil {
+		dm.gormMap = make(map[string]*gorm.DB)
+	}
+	dm.gormMap[name] = g
+	return g, nil
+}
+
+// openGorm 以底层连接池创建gorm实例
+func openGorm(db ISQL, conf DBConf) (*gorm.DB, error) {
+	db = Unwrap(db)
+	if route, ok := db.(*RouteSQL); ok {
+		db = Unwrap(route.Primary())
+	}
+	var dialector gorm.Dialector
+	switch v := db.(type) {
+	case *PSql:
+		if v.db == nil {
+			return nil, fmt.Errorf("database %s not connected", v.name)
+		}
+		dialector = postgres.New(postgres.Config{Conn: stdlib.OpenDBFromPool(v.db)})
+	case *MSql:
+		if v.db == nil {
+			return nil, fmt.Errorf("database %s not connected", v.name)
+		}
+		dialector = mysql.New(mysql.Config{Conn: v.db, SkipInitializeWithVersion: v.dbType == "Doris"})
+	case *SQLite:
+		if v.db == nil {
+			return nil, fmt.Errorf("database %s not connected", v.name)
+		}
+		dialector = gormSQLite{conn: v.db}
+	default:
+		return nil, fmt.Errorf("dbx: gorm does not support %v", db.Dialect())
+	}
+	return gorm.Open(dialector, &gorm.Config{Logger: gormLogger(conf)})
+}
+
+// closeGorm 关闭为PostgreSQL连接池创建的database/sql包装，连接池本身由ISQL关闭
+func closeGorm(g *gorm.DB) error {
+	if g.Dialector.Name() != "postgres" {
+		return nil
+	}
+	sqlDB, err := g.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// gormLogWriter 将gorm日志写入logx
+type gormLogWriter struct{}
+
+func (gormLogWriter) Printf(format string, args ...any) {
+	logx.InfofM(context.Background(), "dbx", format, args...)
+}
+
+var gormLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent, "error": logger.Error, "warn": logger.Warn, "info": logger.Info,
+}
+
+// gormLogger 按gorm_log与slow_ms创建gorm日志
+func gormLogger(conf DBConf) logger.Interface {
+	level, ok := gormLogLevels[strings.ToLower(getOrDefault(conf, "gorm_log", "warn"))]
+	if !ok {
+		level = logger.Warn
+	}
+	return logger.New(gormLogWriter{}, logger.Config{
+		SlowThreshold:             time.Duration(getIntOr(conf, "slow_ms", 200)) * time.Millisecond,
+		LogLevel:                  level,
+		IgnoreRecordNotFoundError: true,
+	})
+}
+
+// BeforeCreate gorm创建前生成空的ID
+func (o *Obj) BeforeCreate(tx *gorm.DB) error {
+	if o.ID.IsEmpty() {
+		o.ID = NewOID()
+	}
+	return nil
+}
+
+// Repo 基于gorm的通用数据访问层，T通常内嵌dbx.Obj；T含gorm.DeletedAt字段时Delete为软删除，
+// 查询自动排除已删除行。filter为JObj条件，语法同Builder.Where
+type Repo[T any] struct {
+	db *gorm.DB
+}
+
+// PageOf Repo.Page的一页结果
+type PageOf[T any] struct {
+	Items      []*T   `json:"items"`
+	Total      int64  `json:"total"` // 未请求WithTotal时为-1
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// NewRepo 创建Repo
+func NewRepo[T any](db *gorm.DB) *Repo[T] {
+	return &Repo[T]{db: db}
+}
+
+// UseRepo 以DB()中名为name的库创建Repo
+func UseRepo[T any](name string) (*Repo[T], error) {
+	db, err := DB().Gorm(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewRepo[T](db), nil
+}
+
+// DB 绑定ctx与模型的gorm会话，用于Repo未覆盖的查询
+func (r *Repo[T]) DB(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Model(new(T))
+}
+
+// Unscoped 包含已软删除行的Repo
+func (r *Repo[T]) Unscoped() *Repo[T] {
+	return &Repo[T]{db: r.db.Unscoped()}
+}
+
+// Tx 在事务中执行fn，fn内使用传入的Repo
+func (r *Repo[T]) Tx(ctx context.Context, fn func(repo *Repo[T]) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Repo[T]{db: tx})
+	})
+}
+
+// Create 插入，内嵌Obj时自动生成ID
+func (r *Repo[T]) Create(ctx context.Context, objs ...*T) error {
+	if len(objs) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(objs).Error
+}
+
+// Save 按主键保存全部字段，主键为空时插入
+func (r *Repo[T]) Save(ctx context.Context, obj *T) error {
+	return r.db.WithContext(ctx).Save(obj).Error
+}
+
+// Get 按主键查询，不存在时返回gorm.ErrRecordNotFound
+func (r *Repo[T]) Get(ctx context.Context, id any) (*T, error) {
+	cond, err := r.byID(id)
+	if err != nil {
+		return nil, err
+	}
+	obj := new(T)
+	if err := r.db.WithContext(ctx).Where(cond).First(obj).Error; err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Find 按filter查询，orderBy中"-col"表示降序
+func (r *Repo[T]) Find(ctx context.Context, filter jsonx.JObj, orderBy ...string) ([]*T, error) {
+	db, err := r.where(ctx, filter, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]*T, 0)
+	return objs, db.Find(&objs).Error
+}
+
+// First 按filter查询第一行，不存在时返回gorm.ErrRecordNotFound
+func (r *Repo[T]) First(ctx context.Context, filter jsonx.JObj, orderBy ...string) (*T, error) {
+	db, err := r.where(ctx, filter, orderBy)
+	if err != nil {
+		return nil, err
+	}
+	obj := new(T)
+	if db = db.Limit(1).Find(obj); db.Error != nil {
+		return nil, db.Error
+	}
+	if db.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return obj, nil
+}
+
+// Count 按filter计数
+func (r *Repo[T]) Count(ctx context.Context, filter jsonx.JObj) (int64, error) {
+	db, err := r.where(ctx, filter, nil)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	return n, db.Count(&n).Error
+}
+
+// Update 按主键更新部分列，返回影响行数
+func (r *Repo[T]) Update(ctx context.Context, id any, fields jsonx.JObj) (int64, error) {
+	cond, err := r.byID(id)
+	if err != nil {
+		return 0, err
+	}
+	values := make(map[string]any, len(fields))
+	for col, val := range fields {
+		if !IsIdent(col) {
+			return 0, fmt.Errorf("dbx: bad column name %q", col)
+		}
+		values[col] = plainVal(val)
+	}
+	db := r.DB(ctx).Where(cond).Updates(values)
+	return db.RowsAffected, db.Error
+}
+
+// Delete 按主键删除，含gorm.DeletedAt时为软删除
+func (r *Repo[T]) Delete(ctx context.Context, ids ...any) (int64, error) {
+	return r.delete(r.db.WithContext(ctx), ids)
+}
+
+// HardDelete 按主键物理删除
+func (r *Repo[T]) HardDelete(ctx context.Context, ids ...any) (int64, error) {
+	return r.delete(r.db.WithContext(ctx).Unscoped(), ids)
+}
+
+func (r *Repo[T]) delete(db *gorm.DB, ids []any) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	cond, err := r.byID(ids...)
+	if err != nil {
+		return 0, err
+	}
+	db = db.Where(cond).Delete(new(T))
+	return db.RowsAffected, db.Error
+}
+
+// Restore 恢复软删除的行
+func (r *Repo[T]) Restore(ctx context.Context, ids ...any) (int64, error) {
+	sch, err := r.schema()
+	if err != nil {
+		return 0, err
+	}
+	var deletedAt *schema.Field
+	for _, field := range sch.Fields {
+		if field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			deletedAt = field
+		}
+	}
+	if deletedAt == nil {
+		return 0, fmt.Errorf("dbx: %v has no gorm.DeletedAt field", sch.Name)
+	}
+	cond, err := r.byID(ids...)
+	if err != nil {
+		return 0, err
+	}
+	db := r.DB(ctx).Unscoped().Where(cond).UpdateColumn(deletedAt.DBName, nil)
+	return db.RowsAffected, db.Error
+}
+
+// Upsert 分批写入；WithConflict指定冲突策略与冲突键(默认主键)，ConflictUpdate以新值覆盖除主键与创建时间外的列
+func (r *Repo[T]) Upsert(ctx context.Context, objs []*T, opts ...BulkOpt) (int64, error) {
+	conf := newBulkConf(opts)
+	onConflict := clause.OnConflict{DoNothing: conf.Conflict == ConflictIgnore, UpdateAll: conf.Conflict == ConflictUpdate}
+	for _, key := range conf.Keys {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: key})
+	}
+	total := int64(0)
+	for start := 0; start < len(objs); start += conf.BatchSize {
+		end := min(start+conf.BatchSize, len(objs))
+		db := r.db.WithContext(ctx)
+		if conf.Conflict != ConflictError {
+			db = db.Clauses(onConflict)
+		}
+		db = db.Create(objs[start:end])
+		total += db.RowsAffected
+		if db.Error != nil {
+			return total, db.Error
+		}
+		if conf.Progress != nil {
+			conf.Progress(end, len(objs))
+		}
+	}
+	return total, nil
+}
+
+// Page 按filter分页，req同Paginate：设置OrderBy时为keyset分页，否则按OFFSET
+func (r *Repo[T]) Page(ctx context.Context, filter jsonx.JObj, req PageReq) (*PageOf[T], error) {
+	size, cursor, err := req.resolve()
+	if err != nil {
+		return nil, err
+	}
+	keys, descs, err := pageKeys(req.OrderBy, cursor)
+	if err != nil {
+		return nil, err
+	}
+	page := &PageOf[T]{Total: -1}
+	if req.WithTotal {
+		if page.Total, err = r.Count(ctx, filter); err != nil {
+			return nil, err
+		}
+	}
+	db, err := r.where(ctx, filter, req.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	if len(cursor.Keys) > 0 {
+		rd := &render{d: r.dialect(), qmark: true}
+		db = db.Where(keysetCond(rd, keys, descs, cursor.Keys), rd.args...)
+	} else if cursor.Offset > 0 {
+		db = db.Offset(cursor.Offset)
+	}
+	items := make([]*T, 0)
+	if err := db.Limit(size + 1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if page.HasMore = len(items) > size; page.HasMore {
+		items = items[:size]
+	}
+	page.Items = items
+	if !page.HasMore {
+		return page, nil
+	}
+	sch, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+	last := reflect.ValueOf(items[len(items)-1]).Elem()
+	page.NextCursor, err = nextCursor(cursor, size, keys, func(key string) (any, bool) {
+		field := sch.LookUpField(key)
+		if field == nil {
+			return nil, false
+		}
+		val, _ := field.ValueOf(ctx, last)
+		if valuer, ok := val.(driver.Valuer); ok {
+			v, err := valuer.Value()
+			return v, err == nil
+		}
+		return val, true
+	})
+	return page, err
+}
+
+// where 渲染filter与排序
+func (r *Repo[T]) where(ctx context.Context, filter jsonx.JObj, orderBy []string) (*gorm.DB, error) {
+	db := r.DB(ctx)
+	if len(filter) > 0 {
+		rd := &render{d: r.dialect(), qmark: true}
+		expr := rd.filter(filter)
+		if rd.err != nil {
+			return nil, rd.err
+		}
+		if expr != "" {
+			db = db.Where(expr, rd.args...)
+		}
+	}
+	for _, col := range orderBy {
+		name := strings.TrimPrefix(strings.TrimPrefix(col, "-"), "+")
+		if !IsIdent(name) {
+			return nil, fmt.Errorf("dbx: bad order column %q", col)
+		}
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: name}, Desc: strings.HasPrefix(col, "-")})
+	}
+	return db, nil
+}
+
+// byID 主键条件，多个id时为IN
+func (r *Repo[T]) byID(ids ...any) (clause.Expression, error) {
+	sch, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("dbx: %v has no primary key", sch.Name)
+	}
+	col := clause.Column{Table: clause.CurrentTable, Name: sch.PrioritizedPrimaryField.DBName}
+	if len(ids) == 1 {
+		return clause.Eq{Column: col, Value: ids[0]}, nil
+	}
+	return clause.IN{Column: col, Values: ids}, nil
+}
+
+// schema 解析T的gorm模型(有缓存)
+func (r *Repo[T]) schema() (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// dialect gorm实例对应的方言
+func (r *Repo[T]) dialect() Dialect {
+	return DialectOf(r.db.Dialector.Name())
+}
@@ -0,0 +1,206 @@
+package dbx
+
+import (
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// gormSQLite 基于已打开的modernc连接池的gorm方言；
+// 社区的纯Go SQLite方言会再注册一个同名驱动，与modernc冲突
+type gormSQLite struct {
+	conn gorm.ConnPool
+}
+
+// Name 方言名
+func (gormSQLite) Name() string {
+	return "sqlite"
+}
+
+// Initialize 注册回调；SQLite 3.35起支持RETURNING
+func (d gormSQLite) Initialize(db *gorm.DB) error {
+	db.ConnPool = d.conn
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
+		CreateClauses:        []string{"INSERT", "VALUES", "ON CONFLICT", "RETURNING"},
+		UpdateClauses:        []string{"UPDATE", "SET", "FROM", "WHERE", "RETURNING"},
+		DeleteClauses:        []string{"DELETE", "FROM", "WHERE", "RETURNING"},
+		LastInsertIDReversed: true,
+	})
+	db.ClauseBuilders["LIMIT"] = func(c clause.Clause, builder clause.Builder) {
+		limit, ok := c.Expression.(clause.Limit)
+		if !ok {
+			c.Build(builder)
+			return
+		}
+		// SQLite的OFFSET须跟在LIMIT之后，-1表示不限
+		n := -1
+		if limit.Limit != nil && *limit.Limit >= 0 {
+			n = *limit.Limit
+		}
+		if n >= 0 || limit.Offset > 0 {
+			builder.WriteString("LIMIT " + strconv.Itoa(n))
+		}
+		if limit.Offset > 0 {
+			builder.WriteString(" OFFSET " + strconv.Itoa(limit.Offset))
+		}
+	}
+	db.ClauseBuilders["FOR"] = func(c clause.Clause, builder clause.Builder) {
+		if _, ok := c.Expression.(clause.Locking); !ok {
+			c.Build(builder)
+		}
+	}
+	return nil
+}
+
+// Migrator 迁移器，不支持修改列与约束
+func (d gormSQLite) Migrator(db *gorm.DB) gorm.Migrator {
+	return gormSQLiteMigrator{migrator.Migrator{Config: migrator.Config{DB: db, Dialector: d, CreateIndexAfterCreateTable: true}}}
+}
+
+// DataTypeOf 字段的列类型
+func (gormSQLite) DataTypeOf(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "numeric"
+	case schema.Int, schema.Uint:
+		if field.AutoIncrement {
+			return "integer PRIMARY KEY AUTOINCREMENT"
+		}
+		return "integer"
+	case schema.Float:
+		return "real"
+	case schema.String:
+		return "text"
+	case schema.Time:
+		if typ, ok := field.TagSettings["TYPE"]; ok {
+			return typ
+		}
+		return "datetime"
+	case schema.Bytes:
+		return "blob"
+	}
+	return string(field.DataType)
+}
+
+// DefaultValueOf 自增列写NULL以取得新值
+func (gormSQLite) DefaultValueOf(field *schema.Field) clause.Expression {
+	if field.AutoIncrement {
+		return clause.Expr{SQL: "NULL"}
+	}
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+// BindVarTo 占位符
+func (gormSQLite) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v any) {
+	writer.WriteByte('?')
+}
+
+// QuoteTo 引用标识符
+func (gormSQLite) QuoteTo(writer clause.Writer, str string) {
+	writer.WriteString(DialectSQLite.Quote(str))
+}
+
+// Explain 展开参数后的SQL，用于日志
+func (gormSQLite) Explain(sql string, vars ...any) string {
+	return logger.ExplainSQL(sql, nil, `"`, vars...)
+}
+
+// SavePoint 设置保存点
+func (gormSQLite) SavePoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + DialectSQLite.Quote(name)).Error
+}
+
+// RollbackTo 回滚到保存点
+func (gormSQLite) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + DialectSQLite.Quote(name)).Error
+}
+
+// Translate 将唯一约束与外键错误转为gorm错误(需开启TranslateError)
+func (gormSQLite) Translate(err error) error {
+	var sqlErr *sqlite.Error
+	if !errors.As(err, &sqlErr) {
+		return err
+	}
+	switch sqlErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return gorm.ErrDuplicatedKey
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return gorm.ErrForeignKeyViolated
+	}
+	return err
+}
+
+// gormSQLiteMigrator 以sqlite_master与pragma查询表结构
+type gormSQLiteMigrator struct {
+	migrator.Migrator
+}
+
+// CurrentDatabase 当前库名
+func (m gormSQLiteMigrator) CurrentDatabase() string {
+	return "main"
+}
+
+// GetTables 全部表名
+func (m gormSQLiteMigrator) GetTables() ([]string, error) {
+	tables := make([]string, 0)
+	return tables, m.DB.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&tables).Error
+}
+
+// HasTable 表是否存在
+func (m gormSQLiteMigrator) HasTable(value any) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		return m.DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", stmt.Table).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// DropTable 删除表，SQLite不支持CASCADE
+func (m gormSQLiteMigrator) DropTable(values ...any) error {
+	values = m.ReorderModels(values, false)
+	for i := len(values) - 1; i >= 0; i-- {
+		err := m.RunWithValue(values[i], func(stmt *gorm.Statement) error {
+			return m.DB.Exec("DROP TABLE IF EXISTS ?", clause.Table{Name: stmt.Table}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasColumn 列是否存在
+func (m gormSQLiteMigrator) HasColumn(value any, name string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(name); field != nil {
+				name = field.DBName
+			}
+		}
+		return m.DB.Raw("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", stmt.Table, name).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// HasIndex 索引是否存在
+func (m gormSQLiteMigrator) HasIndex(value any, name string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema != nil {
+			if idx := stmt.Schema.LookIndex(name); idx != nil {
+				name = idx.Name
+			}
+		}
+		return m.DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?", stmt.Table, name).Row().Scan(&count)
+	})
+	return count > 0
+}
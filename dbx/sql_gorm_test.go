@@ -0,0 +1,218 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlLog 记录gorm生成的SQL
+type sqlLog struct {
+	sqls []string
+}
+
+func (l *sqlLog) LogMode(logger.LogLevel) logger.Interface              { return l }
+func (l *sqlLog) Info(ctx context.Context, format string, args ...any)  {}
+func (l *sqlLog) Warn(ctx context.Context, format string, args ...any)  {}
+func (l *sqlLog) Error(ctx context.Context, format string, args ...any) {}
+func (l *sqlLog) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	l.sqls = append(l.sqls, sql)
+}
+
+type repoUser struct {
+	Obj
+	Name string `gorm:"column:name"`
+	Age  int    `gorm:"column:age"`
+}
+
+// dryRepo 不连接数据库，只生成SQL的PostgreSQL Repo
+func dryRepo(t *testing.T) (*Repo[repoUser], *sqlLog) {
+	conn, err := sql.Open("pgx", "postgres://localhost:1/none")
+	assert.NoError(t, err)
+	log := &sqlLog{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}),
+		&gorm.Config{Logger: log, DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	assert.NoError(t, err)
+	return NewRepo[repoUser](db), log
+}
+
+func TestRepo(t *testing.T) {
+	ctx := context.Background()
+	repo, log := dryRepo(t)
+
+	user := &repoUser{Name: "tom"}
+	assert.NoError(t, repo.Create(ctx, user))
+	assert.False(t, user.ID.IsEmpty())
+	assert.Contains(t, log.sqls[0], `INSERT INTO "repo_users"`)
+
+	_, err := repo.Find(ctx, jsonx.JObj{"age": jsonx.JObj{"$gte": 18}, "name": []any{"tom", "jerry"}}, "-age")
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "repo_users" WHERE ("age" >= 18 AND "name" IN ('tom', 'jerry')) AND "repo_users"."deleted_at" IS NULL ORDER BY "age" DESC`, log.sqls[1])
+
+	_, err = repo.Delete(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^UPDATE "repo_users" SET "deleted_at"=.* WHERE "repo_users"."id" = '`+user.ID.Hex()+`' AND "repo_users"."deleted_at" IS NULL$`, log.sqls[2])
+	_, err = repo.HardDelete(ctx, "a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, `DELETE FROM "repo_users" WHERE "repo_users"."id" IN ('a','b')`, log.sqls[3])
+	_, err = repo.Restore(ctx, "a")
+	assert.NoError(t, err)
+	assert.Contains(t, log.sqls[4], `SET "deleted_at"=NULL`)
+
+	_, err = repo.Upsert(ctx, []*repoUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}, WithBatchSize(2), WithConflict(ConflictUpdate))
+	assert.NoError(t, err)
+	assert.Len(t, log.sqls, 7)
+	assert.Contains(t, log.sqls[5], `ON CONFLICT ("id") DO UPDATE SET`)
+
+	_, err = repo.Find(ctx, jsonx.JObj{"$bad": 1})
+	assert.Error(t, err)
+	_, err = repo.Update(ctx, "a", jsonx.JObj{"name; DROP": 1})
+	assert.Error(t, err)
+}
+
+func TestRepoPage(t *testing.T) {
+	ctx := context.Background()
+	repo, log := dryRepo(t)
+	cursor, err := encodeCursor(pageCursor{Keys: []any{int64(30), "x"}})
+	assert.NoError(t, err)
+	page, err := repo.Page(ctx, jsonx.JObj{"name": "tom"}, PageReq{Size: 10, Cursor: cursor, WithTotal: true, OrderBy: []string{"-age", "id"}})
+	assert.NoError(t, err)
+	assert.False(t, page.HasMore)
+	assert.Equal(t, int64(0), page.Total)
+	assert.Equal(t, `SELECT count(*) FROM "repo_users" WHERE "name" = 'tom' AND "repo_users"."deleted_at" IS NULL`, log.sqls[0])
+	assert.Equal(t, `SELECT * FROM "repo_users" WHERE "name" = 'tom' AND ((("age" < 30) OR ("age" = 30 AND "id" > 'x'))) `+
+		`AND "repo_users"."deleted_at" IS NULL ORDER BY "age" DESC,"id" LIMIT 11`, log.sqls[1])
+
+	_, err = repo.Page(ctx, nil, PageReq{Size: 10, Page: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM "repo_users" WHERE "repo_users"."deleted_at" IS NULL LIMIT 11 OFFSET 20`, log.sqls[2])
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	cursor, err = encodeCursor(pageCursor{Keys: []any{now}})
+	assert.NoError(t, err)
+	decoded, err := decodeCursor(cursor)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(decoded.Keys[0].(time.Time)))
+}
+
+func TestGormUnsupported(t *testing.T) {
+	dm := &DBMgr{dbMap: map[string]ISQL{"local": NewSQLite("local", &jsonx.JObj{}), "fake": &fakeSQL{fakeQuery: &fakeQuery{}}},
+		confMap: map[string]DBConf{}}
+	_, err := dm.Gorm("local")
+	assert.ErrorContains(t, err, "not connected")
+	_, err = dm.Gorm("fake")
+	assert.ErrorContains(t, err, "does not support")
+	_, err = dm.Gorm("missing")
+	assert.Error(t, err)
+}
+
+func TestGormUnlocked(t *testing.T) {
+	// 接受连接但不应答的服务端，使gorm.Open的ping阻塞到超时
+	srv, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer srv.Close()
+	go func() {
+		for {
+			conn, err := srv.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	ctx := context.Background()
+	conf := &jsonx.JObj{"db_url": "postgres://u@" + srv.Addr().String() + "/db?connect_timeout=1"}
+	cfg, err := (&PSql{}).PoolConfig(conf)
+	assert.NoError(t, err)
+	pool, err := pgxpool.NewWithConfig(ctx, cfg) // 不预先建立连接
+	assert.NoError(t, err)
+	defer pool.Close()
+	dm := &DBMgr{dbMap: map[string]ISQL{"main": &PSql{name: "main", conf: conf, db: pool, dbType: "PostgreSQL"},
+		"other": &fakeSQL{fakeQuery: &fakeQuery{}}}, confMap: map[string]DBConf{"main": conf}}
+	done := make(chan error, 1)
+	go func() {
+		_, err := dm.Gorm("main")
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 创建期间其他库仍可使用
+	start := time.Now()
+	_, err = dm.Use("other")
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Error(t, <-done)
+	assert.Empty(t, dm.gormMap)
+}
+
+func TestRepoSQLite(t *testing.T) {
+	ctx := context.Background()
+	dm := &DBMgr{dbMap: map[string]ISQL{}, confMap: map[string]DBConf{}}
+	assert.NoError(t, dm.Init(ctx, map[string]DBConf{"local": &jsonx.JObj{"db_url": "sqlite://:memory:", "gorm_log": "silent"}}))
+	defer dm.CloseAll(ctx)
+	g, err := dm.Gorm("local")
+	assert.NoError(t, err)
+	assert.NoError(t, g.AutoMigrate(&repoUser{}))
+	assert.NoError(t, g.AutoMigrate(&repoUser{}), "second run is a no-op")
+	assert.True(t, g.Migrator().HasIndex(&repoUser{}, "idx_repo_users_deleted_at"))
+	repo := NewRepo[repoUser](g)
+
+	tom, jerry := &repoUser{Name: "tom", Age: 18}, &repoUser{Name: "jerry", Age: 7}
+	assert.NoError(t, repo.Create(ctx, tom, jerry))
+	got, err := repo.Get(ctx, tom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "tom", got.Name)
+	assert.False(t, got.CreatedAt.IsZero())
+
+	n, err := repo.Update(ctx, jerry.ID, jsonx.JObj{"age": 8})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	users, err := repo.Find(ctx, jsonx.JObj{"age": jsonx.JObj{"$lt": 10}})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, 8, users[0].Age)
+
+	// 软删除、恢复与分页
+	_, err = repo.Delete(ctx, tom.ID)
+	assert.NoError(t, err)
+	_, err = repo.Get(ctx, tom.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	count, err := repo.Unscoped().Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	_, err = repo.Restore(ctx, tom.ID)
+	assert.NoError(t, err)
+	page, err := repo.Page(ctx, nil, PageReq{Size: 1, WithTotal: true, OrderBy: []string{"-age", "id"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, "tom", page.Items[0].Name)
+	page, err = repo.Page(ctx, nil, PageReq{Size: 1, Cursor: page.NextCursor, OrderBy: []string{"-age", "id"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "jerry", page.Items[0].Name)
+	assert.False(t, page.HasMore)
+	page, err = repo.Page(ctx, nil, PageReq{Size: 1, Page: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+
+	// 按主键upsert
+	tom.Age = 19
+	_, err = repo.Upsert(ctx, []*repoUser{tom, {Name: "spike"}}, WithConflict(ConflictUpdate))
+	assert.NoError(t, err)
+	got, err = repo.Get(ctx, tom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 19, got.Age)
+	count, err = repo.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
@@ -0,0 +1,451 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// Migration 一个版本的迁移脚本，文件名形如 0001_create_users.up.sql / 0001_create_users.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus 迁移版本状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Missing   bool // 已应用但脚本已不存在
+	Dirty     bool // 执行中途失败，须人工修复后清除簿记表的dirty标记
+}
+
+// Migrator 迁移执行器，已应用版本按DBConf名记录在簿记表中
+type Migrator struct {
+	name   string
+	db     ISQL
+	fsys   fs.FS
+	table  string
+	dryRun io.Writer
+	noLock bool
+}
+
+// MigrateOpt 迁移选项
+type MigrateOpt func(m *Migrator)
+
+// WithMigrateTable 设置簿记表名，默认dbx_migrations
+func WithMigrateTable(table string) MigrateOpt {
+	return func(m *Migrator) { m.table = table }
+}
+
+// WithDryRun 只将待执行的SQL输出到w，不执行也不记录
+func WithDryRun(w io.Writer) MigrateOpt {
+	return func(m *Migrator) { m.dryRun = w }
+}
+
+// WithoutLock 不加迁移锁，用于Doris等无会话锁的数据库，须由调用方保证同时只有一个实例执行迁移
+func WithoutLock() MigrateOpt {
+	return func(m *Migrator) { m.noLock = true }
+}
+
+// NewMigrator 创建迁移执行器；fsys可为embed.FS或MigrationDir
+func NewMigrator(name string, db ISQL, fsys fs.FS, opts ...MigrateOpt) *Migrator {
+	m := &Migrator{name: name, db: db, fsys: fsys, table: "dbx_migrations"}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// MigrationDir 以目录作为迁移脚本来源
+func MigrationDir(dir string) fs.FS {
+	return os.DirFS(dir)
+}
+
+// Migrator 为已初始化的数据库创建迁移执行器，簿记表名可由配置migrate_table指定
+func (dm *DBMgr) Migrator(name string, fsys fs.FS, opts ...MigrateOpt) (*Migrator, error) {
+	db, err := dm.Use(name)
+	if err != nil {
+		return nil, err
+	}
+	dm.mutex.RLock()
+	conf := dm.confMap[name]
+	dm.mutex.RUnlock()
+	if table := getOrDefault(conf, "migrate_table", ""); table != "" {
+		opts = append([]MigrateOpt{WithMigrateTable(table)}, opts...)
+	}
+	return NewMigrator(name, db, fsys, opts...), nil
+}
+
+var migrationRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load 读取并按版本排序迁移脚本
+func (m *Migrator) Load() ([]*Migration, error) {
+	entries, err := fs.ReadDir(m.fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations error: %v", err)
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(m.fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %v error: %v", entry.Name(), err)
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d has two names: %v, %v", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+	migs := make([]*Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%v has no up script", mig.Version, mig.Name)
+		}
+		migs = append(migs, mig)
+	}
+	sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
+	return migs, nil
+}
+
+// Status 列出全部版本及其应用状态
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migs, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+	if m.dryRun == nil {
+		if err := m.ensureTable(ctx); err != nil {
+			return nil, err
+		}
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(migs))
+	for _, mig := range migs {
+		st := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			st.Applied, st.AppliedAt, st.Dirty = true, row.AppliedAt, row.Dirty
+			delete(applied, mig.Version)
+		}
+		status = append(status, st)
+	}
+	for _, row := range applied {
+		status = append(status, MigrationStatus{Version: row.Version, Name: row.Name, Applied: true, AppliedAt: row.AppliedAt, Missing: true, Dirty: row.Dirty})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+// Up 按版本顺序执行全部未应用的迁移，返回执行个数
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	migs, err := m.Load()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = m.withLock(ctx, func() error {
+		applied, err := m.clean(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migs {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, mig, mig.Up, true); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down 按版本倒序回滚最近n个已应用的迁移，返回回滚个数
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	migs, err := m.Load()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = m.withLock(ctx, func() error {
+		applied, err := m.clean(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(migs) - 1; i >= 0 && count < n; i-- {
+			mig := migs[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migration %d_%v has no down script", mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, mig, mig.Down, false); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// withLock 建簿记表并持有迁移锁执行fn；dry-run与WithoutLock不加锁，数据库不支持会话锁时返回错误
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if m.dryRun != nil {
+		return fn()
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	if m.noLock {
+		return fn()
+	}
+	return withDBLock(ctx, m.db, "dbx_migrate:"+m.name, fn)
+}
+
+// clean 查询已应用的版本，存在dirty版本时返回错误
+func (m *Migrator) clean(ctx context.Context) (map[int64]appliedRow, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range applied {
+		if row.Dirty {
+			return nil, fmt.Errorf("migration %d_%v is dirty, fix the database then clear dirty in %v", row.Version, row.Name, m.table)
+		}
+	}
+	return applied, nil
+}
+
+// apply 执行一个迁移脚本并更新簿记表；PostgreSQL与SQLite在事务中执行，
+// MySQL与Doris的DDL会隐式提交，逐条执行并以dirty标记未完成的版本
+func (m *Migrator) apply(ctx context.Context, mig *Migration, script string, up bool) error {
+	stmts := SplitSQL(m.db.Dialect(), script)
+	direction := gox.IfElse(up, "up", "down").(string)
+	if m.dryRun != nil {
+		fmt.Fprintf(m.dryRun, "-- %d_%v %v\n", mig.Version, mig.Name, direction)
+		for _, stmt := range stmts {
+			fmt.Fprintf(m.dryRun, "%v;\n", stmt)
+		}
+		return nil
+	}
+	var err error
+	if d := m.db.Dialect(); d == DialectPostgres || d == DialectSQLite {
+		err = WithTx(ctx, m.db, func(tx ITx) error {
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			return m.book(ctx, tx, mig, up, false)
+		})
+	} else {
+		err = m.applyDirty(ctx, mig, stmts, up)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %d_%v %v error: %v", mig.Version, mig.Name, direction, err)
+	}
+	return nil
+}
+
+// applyDirty 先标记dirty再逐条执行，全部成功后清除标记(回滚时删除记录)
+func (m *Migrator) applyDirty(ctx context.Context, mig *Migration, stmts []string, up bool) error {
+	if err := m.book(ctx, m.db, mig, up, true); err != nil {
+		return err
+	}
+	for i, stmt := range stmts {
+		if _, err := m.db.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d/%d: %v, version marked dirty", i+1, len(stmts), err)
+		}
+	}
+	if up {
+		_, err := Update(m.table).Set("dirty", false).Where(m.key(mig)).Exec(ctx, m.db)
+		return err
+	}
+	_, err := Delete(m.table).Where(m.key(mig)).Exec(ctx, m.db)
+	return err
+}
+
+// book 更新簿记表：事务内执行时直接写入结果，否则写入dirty标记
+func (m *Migrator) book(ctx context.Context, db IQuery, mig *Migration, up, dirty bool) error {
+	var book *Builder
+	switch {
+	case up:
+		book = Insert(m.table).Rows(jsonx.JObj{"conf_name": m.name, "version": mig.Version, "name": mig.Name, "applied_at": time.Now(), "dirty": dirty})
+	case dirty:
+		book = Update(m.table).Set("dirty", true).Where(m.key(mig))
+	default:
+		book = Delete(m.table).Where(m.key(mig))
+	}
+	_, err := book.Exec(ctx, db)
+	return err
+}
+
+// key 簿记表中的版本条件
+func (m *Migrator) key(mig *Migration) jsonx.JObj {
+	return jsonx.JObj{"conf_name": m.name, "version": mig.Version}
+}
+
+type appliedRow struct {
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+	Dirty     bool      `json:"dirty"`
+}
+
+// applied 查询当前DBConf已应用的版本；dry-run时簿记表不存在视为全部未应用
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedRow, error) {
+	sql, args, err := Select(m.table, "version", "name", "applied_at", "dirty").
+		Where(jsonx.JObj{"conf_name": m.name}).Build(m.db.Dialect())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := QueryAs[appliedRow](ctx, m.db, sql, args...)
+	if err != nil {
+		if m.dryRun != nil {
+			return map[int64]appliedRow{}, nil
+		}
+		return nil, fmt.Errorf("query %v error: %v", m.table, err)
+	}
+	applied := make(map[int64]appliedRow, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// ensureTable 按方言创建簿记表
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	if !IsIdent(m.table) {
+		return fmt.Errorf("dbx: bad migrate table name %q", m.table)
+	}
+	d := m.db.Dialect()
+	var ddl string
+	switch d {
+	case DialectPostgres:
+		ddl = "CREATE TABLE IF NOT EXISTS %v (conf_name VARCHAR(128) NOT NULL, version BIGINT NOT NULL, " +
+			"name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL, dirty BOOLEAN NOT NULL, PRIMARY KEY (conf_name, version))"
+	case DialectDoris:
+		ddl = "CREATE TABLE IF NOT EXISTS %v (conf_name VARCHAR(128) NOT NULL, version BIGINT NOT NULL, " +
+			"name VARCHAR(255) NOT NULL, applied_at DATETIME NOT NULL, dirty BOOLEAN NOT NULL) UNIQUE KEY(conf_name, version) " +
+			`DISTRIBUTED BY HASH(conf_name) BUCKETS 1 PROPERTIES ("replication_num" = "1")`
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS %v (conf_name VARCHAR(128) NOT NULL, version BIGINT NOT NULL, " +
+			"name VARCHAR(255) NOT NULL, applied_at DATETIME NOT NULL, dirty BOOLEAN NOT NULL, PRIMARY KEY (conf_name, version))"
+	}
+	if _, err := m.db.Exec(ctx, fmt.Sprintf(ddl, d.Quote(m.table))); err != nil {
+		return fmt.Errorf("create %v error: %v", m.table, err)
+	}
+	return nil
+}
+
+// locker 支持会话级互斥锁的数据库
+type locker interface {
+	withLock(ctx context.Context, key string, fn func() error) error
+}
+
+// lockRetryInterval 会话锁被占用时的重试间隔
+const lockRetryInterval = 500 * time.Millisecond
+
+// withDBLock 持有db的会话锁执行fn，db不支持会话锁时返回错误
+func withDBLock(ctx context.Context, db any, key string, fn func() error) error {
+	if l, ok := db.(locker); ok {
+		return l.withLock(ctx, key, fn)
+	}
+	return fmt.Errorf("dbx: %T has no session lock for %v", db, key)
+}
+
+// SplitSQL 按分号切分SQL脚本，跳过引号、注释与PostgreSQL的$tag$块
+func SplitSQL(d Dialect, script string) []string {
+	var stmts []string
+	start := 0
+	flush := func(end int) {
+		if stmt := strings.TrimSpace(script[start:end]); stmt != "" && !onlyComments(stmt) {
+			stmts = append(stmts, stmt)
+		}
+	}
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' && d != DialectPostgres {
+					i++
+				}
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += 2 + end + 1
+			} else {
+				i = len(script)
+			}
+		case c == '$':
+			if tag := dollarTag(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(script)
+				}
+			}
+		case c == ';':
+			flush(i)
+			start = i + 1
+		}
+	}
+	flush(len(script))
+	return stmts
+}
+
+var dollarRegex = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// dollarTag 匹配$$或$tag$
+func dollarTag(s string) string {
+	return dollarRegex.FindString(s)
+}
+
+// onlyComments 语句是否只含注释
+func onlyComments(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQL 基于fakeQuery的ISQL，事务与连接共享记录
+type fakeSQL struct {
+	*fakeQuery
+	commits, rollbacks, locks int
+	failOn                    string // Exec遇到包含该文本的语句时失败
+}
+
+func (f *fakeSQL) Exec(ctx context.Context, query string, args ...any) (ExecResult, error) {
+	if f.failOn != "" && strings.Contains(query, f.failOn) {
+		f.execs = append(f.execs, query)
+		return ExecResult{}, errors.New("exec failed")
+	}
+	return f.fakeQuery.Exec(ctx, query, args...)
+}
+
+func (f *fakeSQL) withLock(ctx context.Context, key string, fn func() error) error {
+	f.locks++
+	return fn()
+}
+
+func (f *fakeSQL) Connect(ctx context.Context) error { return nil }
+
+func (f *fakeSQL) Close(ctx context.Context) error { return nil }
+
+func (f *fakeSQL) Begin(ctx context.Context) (ITx, error) { return &fakeTx{f}, nil }
+
+func (f *fakeSQL) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any, opts ...BulkOpt) (int64, error) {
+	return sqlBulkInsert(ctx, f, table, columns, rows, newBulkConf(opts))
+}
+
+func (f *fakeSQL) Tables(ctx context.Context) ([]Table, error) { return schemaTables(ctx, f) }
+
+func (f *fakeSQL) Columns(ctx context.Context, table string) ([]Column, error) {
+	return schemaColumns(ctx, f, table)
+}
+
+func (f *fakeSQL) Indexes(ctx context.Context, table string) ([]Index, error) {
+	return schemaIndexes(ctx, f, table)
+}
+
+func (f *fakeSQL) PrimaryKey(ctx context.Context, table string) ([]string, error) {
+	return schemaPrimaryKey(ctx, f, table)
+}
+
+type fakeTx struct{ *fakeSQL }
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	t.rollbacks++
+	return nil
+}
+
+var testMigrations = fstest.MapFS{
+	"0001_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT);\n-- seed\nINSERT INTO users VALUES (1);")},
+	"0001_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"0002_orders.up.sql":  {Data: []byte("CREATE TABLE orders (id INT);")},
+	"0003_fn.up.sql":      {Data: []byte("CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;")},
+	"README.md":           {Data: []byte("ignored")},
+}
+
+func TestMigratorUp(t *testing.T) {
+	db := &fakeSQL{fakeQuery: &fakeQuery{rows: []*jsonx.JObj{{"version": int64(1), "name": "users", "applied_at": "2024-01-02 03:04:05"}}}}
+	m := NewMigrator("main", db, testMigrations)
+	n, err := m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, db.commits)
+	assert.Equal(t, 1, db.locks)
+	assert.Contains(t, db.execs[0], `CREATE TABLE IF NOT EXISTS "dbx_migrations"`)
+	assert.Equal(t, "CREATE TABLE orders (id INT)", db.execs[2])
+	assert.Contains(t, db.execs[3], `INSERT INTO "dbx_migrations"`)
+	assert.Equal(t, "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", db.execs[4])
+
+	status, err := m.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, status, 3)
+	assert.True(t, status[0].Applied)
+	assert.Equal(t, 2024, status[0].AppliedAt.Year())
+	assert.False(t, status[1].Applied)
+
+	_, err = m.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "DROP TABLE users", db.execs[len(db.execs)-2])
+	assert.Contains(t, db.execs[len(db.execs)-1], `DELETE FROM "dbx_migrations"`)
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	db := &fakeSQL{fakeQuery: &fakeQuery{d: DialectMySQL}}
+	out := &bytes.Buffer{}
+	n, err := NewMigrator("main", db, testMigrations, WithDryRun(out)).Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Len(t, db.execs, 1, "dry run only reads applied versions")
+	assert.Contains(t, out.String(), "-- 1_users up\nCREATE TABLE users (id INT);\n-- seed\nINSERT INTO users VALUES (1);\n")
+}
+
+func TestMigratorDirty(t *testing.T) {
+	ctx := context.Background()
+	// MySQL不在事务中执行：先写入dirty记录，逐条执行后清除
+	db := &fakeSQL{fakeQuery: &fakeQuery{d: DialectMySQL}}
+	n, err := NewMigrator("main", db, testMigrations).Up(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Zero(t, db.commits)
+	assert.Contains(t, db.execs[2], "INSERT INTO `dbx_migrations`")
+	assert.Contains(t, db.args[2], true)
+	assert.Equal(t, "CREATE TABLE users (id INT)", db.execs[3])
+	assert.Contains(t, db.execs[5], "UPDATE `dbx_migrations` SET `dirty`")
+
+	// 中途失败时保留dirty标记
+	db = &fakeSQL{fakeQuery: &fakeQuery{d: DialectMySQL}, failOn: "INSERT INTO users"}
+	_, err = NewMigrator("main", db, testMigrations).Up(ctx)
+	assert.ErrorContains(t, err, "statement 2/2")
+	assert.ErrorContains(t, err, "dirty")
+	assert.NotContains(t, db.execs[len(db.execs)-1], "UPDATE")
+
+	// 存在dirty版本时拒绝继续
+	db = &fakeSQL{fakeQuery: &fakeQuery{d: DialectMySQL, rows: []*jsonx.JObj{
+		{"version": int64(1), "name": "users", "applied_at": "2024-01-02 03:04:05", "dirty": int64(1)}}}}
+	m := NewMigrator("main", db, testMigrations)
+	_, err = m.Up(ctx)
+	assert.ErrorContains(t, err, "migration 1_users is dirty")
+	_, err = m.Down(ctx, 1)
+	assert.ErrorContains(t, err, "is dirty")
+	status, err := m.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, status[0].Dirty)
+}
+
+func TestMigratorLock(t *testing.T) {
+	ctx := context.Background()
+	err := withDBLock(ctx, &fakeQuery{}, "k", func() error { return nil })
+	assert.ErrorContains(t, err, "has no session lock")
+	err = (&MSql{dbType: "doris"}).withLock(ctx, "k", func() error { return nil })
+	assert.ErrorContains(t, err, "WithoutLock")
+
+	db := &fakeSQL{fakeQuery: &fakeQuery{}}
+	_, err = NewMigrator("main", db, testMigrations, WithoutLock()).Up(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, db.locks)
+}
+
+func TestSplitSQL(t *testing.T) {
+	stmts := SplitSQL(DialectMySQL, "INSERT INTO t VALUES ('a;b', 'it\\'s'); /* x; */ SELECT 1;\n-- only comment;\n")
+	assert.Equal(t, []string{"INSERT INTO t VALUES ('a;b', 'it\\'s')", "/* x; */ SELECT 1"}, stmts)
+	stmts = SplitSQL(DialectPostgres, `SELECT 'C:\'; DO $body$ BEGIN PERFORM 1; END $body$;`)
+	assert.Equal(t, []string{`SELECT 'C:\'`, `DO $body$ BEGIN PERFORM 1; END $body$`}, stmts)
+}
@@ -0,0 +1,145 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// QueryNamed 以:name命名参数查询，切片参数展开为IN列表
+//
+//	rows, err := dbx.QueryNamed(ctx, db, "SELECT * FROM t WHERE id = :id AND tag IN (:tags)",
+//		jsonx.JObj{"id": 1, "tags": []string{"a", "b"}})
+func QueryNamed(ctx context.Context, db IQuery, query string, params jsonx.JObj) ([]*jsonx.JObj, error) {
+	bound, args, err := BindNamed(db.Dialect(), query, params)
+	if err != nil {
+		return nil, err
+	}
+	return db.Query(ctx, bound, args...)
+}
+
+// QueryEachNamed 以命名参数流式查询
+func QueryEachNamed(ctx context.Context, db IQuery, query string, params jsonx.JObj, fn func(row *jsonx.JObj) error) error {
+	bound, args, err := BindNamed(db.Dialect(), query, params)
+	if err != nil {
+		return err
+	}
+	return db.QueryEach(ctx, bound, args, fn)
+}
+
+// ExecNamed 以命名参数执行写操作
+func ExecNamed(ctx context.Context, db IQuery, query string, params jsonx.JObj) (ExecResult, error) {
+	bound, args, err := BindNamed(db.Dialect(), query, params)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	return db.Exec(ctx, bound, args...)
+}
+
+// BindNamed 将:name改写为方言占位符并按出现顺序生成参数；跳过引号、注释、$tag$块与::类型转换，
+// 缺少或多余的参数均报错
+func BindNamed(d Dialect, query string, params jsonx.JObj) (string, []any, error) {
+	var sb strings.Builder
+	args := make([]any, 0, len(params))
+	used := make(map[string]string, len(params))
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		start := i
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' && d != DialectPostgres {
+					i++
+				}
+			}
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			for i < len(query)-1 && query[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += 2 + end + 1
+			} else {
+				i = len(query) - 1
+			}
+		case c == '$':
+			if tag := dollarTag(query[i:]); tag != "" {
+				if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(query) - 1
+				}
+			}
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// PostgreSQL类型转换 ::type
+			i++
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && isNameChar(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			holder, ok := used[name]
+			// PostgreSQL重复引用同一参数时复用占位符
+			if !ok || d != DialectPostgres {
+				val, has := params[name]
+				if !has {
+					return "", nil, fmt.Errorf("dbx: missing named param :%v", name)
+				}
+				var err error
+				if holder, args, err = bindNamedVal(d, name, plainVal(val), args); err != nil {
+					return "", nil, err
+				}
+				used[name] = holder
+			}
+			sb.WriteString(holder)
+			i = end - 1
+			continue
+		}
+		if i >= len(query) {
+			i = len(query) - 1
+		}
+		sb.WriteString(query[start : i+1])
+	}
+	if len(used) < len(params) {
+		unused := make([]string, 0)
+		for name := range params {
+			if _, ok := used[name]; !ok {
+				unused = append(unused, name)
+			}
+		}
+		sort.Strings(unused)
+		return "", nil, fmt.Errorf("dbx: unused named params %v", unused)
+	}
+	return sb.String(), args, nil
+}
+
+// bindNamedVal 追加参数并返回占位符，切片展开为逗号分隔的多个占位符；driver.Valuer(如StrArr)整体绑定
+func bindNamedVal(d Dialect, name string, val any, args []any) (string, []any, error) {
+	list := asList(val)
+	if _, ok := val.(driver.Valuer); ok || list == nil {
+		args = append(args, val)
+		return d.Placeholder(len(args)), args, nil
+	}
+	if len(list) == 0 {
+		return "", nil, fmt.Errorf("dbx: named param :%v is an empty list", name)
+	}
+	holders := make([]string, len(list))
+	for i, item := range list {
+		args = append(args, item)
+		holders[i] = d.Placeholder(len(args))
+	}
+	return strings.Join(holders, ", "), args, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,42 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindNamed(t *testing.T) {
+	query := `SELECT id::text, ':skip' AS s FROM t -- :comment
+WHERE id = :id AND tag IN (:tags) /* :block */ AND owner = :id AND ids && :arr`
+	params := jsonx.JObj{"id": 7, "tags": []string{"a", "b"}, "arr": LongArr{1, 2}}
+
+	sql, args, err := BindNamed(DialectPostgres, query, params)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT id::text, ':skip' AS s FROM t -- :comment
+WHERE id = $1 AND tag IN ($2, $3) /* :block */ AND owner = $1 AND ids && $4`, sql)
+	assert.Equal(t, []any{7, "a", "b", LongArr{1, 2}}, args)
+
+	sql, args, err = BindNamed(DialectMySQL, "UPDATE t SET a = :a WHERE b = :b OR c = :a", jsonx.JObj{"a": "x", "b": jsonx.NewJInt(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE t SET a = ? WHERE b = ? OR c = ?", sql)
+	assert.Equal(t, []any{"x", int64(2), "x"}, args)
+
+	_, _, err = BindNamed(DialectMySQL, "SELECT :a, :b", jsonx.JObj{"a": 1})
+	assert.EqualError(t, err, "dbx: missing named param :b")
+	_, _, err = BindNamed(DialectMySQL, "SELECT :a", jsonx.JObj{"a": 1, "z": 2, "y": 3})
+	assert.EqualError(t, err, "dbx: unused named params [y z]")
+	_, _, err = BindNamed(DialectMySQL, "SELECT * FROM t WHERE id IN (:ids)", jsonx.JObj{"ids": []int{}})
+	assert.Error(t, err)
+}
+
+func TestExecNamed(t *testing.T) {
+	db := &fakeQuery{d: DialectMySQL}
+	_, err := ExecNamed(context.Background(), db, "DELETE FROM t WHERE id IN (:ids)", jsonx.JObj{"ids": jsonx.JArr{jsonx.NewJInt(1), jsonx.NewJInt(2)}})
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM t WHERE id IN (?, ?)", db.execs[0])
+	assert.Equal(t, []any{int64(1), int64(2)}, db.args[0])
+}
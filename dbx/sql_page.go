@@ -0,0 +1,231 @@
+package dbx
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fengzhi09/golibx/gox"
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+// 分页大小
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 1000
+)
+
+// PageReq 分页请求；Size/Page/Cursor/WithTotal来自客户端，OrderBy由服务端指定
+type PageReq struct {
+	Size      int    `json:"size"`       // 每页行数，默认DefaultPageSize，不超过MaxPageSize
+	Page      int    `json:"page"`       // 页码(从1开始)，无Cursor时按OFFSET跳页
+	Cursor    string `json:"cursor"`     // 上一页返回的NextCursor
+	WithTotal bool   `json:"with_total"` // 是否额外执行COUNT查询总数
+	// OrderBy 排序键，"-col"表示降序；设置后使用keyset分页，键须在结果中且组合唯一(如末尾加id)
+	OrderBy []string `json:"-"`
+}
+
+// Page 一页结果
+type Page struct {
+	Rows       []*jsonx.JObj `json:"rows"`
+	Total      int64         `json:"total"` // 未请求WithTotal时为-1
+	NextCursor string        `json:"next_cursor"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// pageCursor 游标内容：OFFSET分页记录偏移，keyset分页记录上一页末行的键值
+type pageCursor struct {
+	Offset int   `json:"o,omitempty"`
+	Keys   []any `json:"k,omitempty"`
+}
+
+// Paginate 对baseQuery分页查询：设置OrderBy时按键值续读(keyset)，否则按OFFSET/LIMIT；
+// baseQuery作为子查询包装，keyset模式下不要自带ORDER BY
+//
+//	page, err := dbx.Paginate(ctx, db, "SELECT id, name FROM users WHERE shop_id = $1",
+//		dbx.PageReq{Size: 50, Cursor: cursor, OrderBy: []string{"-id"}}, shopID)
+func Paginate(ctx context.Context, db IQuery, baseQuery string, req PageReq, args ...any) (*Page, error) {
+	size, cursor, err := req.resolve()
+	if err != nil {
+		return nil, err
+	}
+	keys, descs, err := pageKeys(req.OrderBy, cursor)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Dialect()
+	base := strings.TrimRight(strings.TrimSpace(baseQuery), ";")
+
+	page := &Page{Total: -1}
+	if req.WithTotal {
+		rows, err := db.Query(ctx, "SELECT COUNT(*) AS total FROM ("+base+") AS _dbx_count", args...)
+		if err != nil {
+			return nil, fmt.Errorf("dbx: page count: %w", err)
+		}
+		if len(rows) > 0 {
+			page.Total = rows[0].GetLong("total")
+		}
+	}
+
+	r := &render{d: d, args: append([]any{}, args...)}
+	r.sb.WriteString("SELECT * FROM (" + base + ") AS _dbx_page")
+	if len(cursor.Keys) > 0 {
+		r.sb.WriteString(" WHERE " + keysetCond(r, keys, descs, cursor.Keys))
+	}
+	if len(keys) > 0 {
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			parts[i] = d.Quote(key) + gox.IfElse(descs[i], " DESC", " ASC").(string)
+		}
+		r.sb.WriteString(" ORDER BY " + strings.Join(parts, ", "))
+	}
+	// 多取一行判断是否还有下一页
+	r.sb.WriteString(fmt.Sprintf(" LIMIT %d", size+1))
+	if len(cursor.Keys) == 0 && cursor.Offset > 0 {
+		r.sb.WriteString(fmt.Sprintf(" OFFSET %d", cursor.Offset))
+	}
+	rows, err := db.Query(ctx, r.sb.String(), r.args...)
+	if err != nil {
+		return nil, err
+	}
+	if page.HasMore = len(rows) > size; page.HasMore {
+		rows = rows[:size]
+	}
+	page.Rows = rows
+	if !page.HasMore {
+		return page, nil
+	}
+	last := *rows[len(rows)-1]
+	page.NextCursor, err = nextCursor(cursor, size, keys, func(key string) (any, bool) {
+		val, ok := last[key]
+		return plainVal(val), ok
+	})
+	return page, err
+}
+
+// resolve 每页行数与起始游标；未给游标时按Page换算偏移
+func (req PageReq) resolve() (int, pageCursor, error) {
+	size := req.Size
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	size = min(size, MaxPageSize)
+	cursor, err := decodeCursor(req.Cursor)
+	if err != nil {
+		return 0, cursor, err
+	}
+	if req.Cursor == "" && req.Page > 1 {
+		cursor.Offset = (req.Page - 1) * size
+	}
+	return size, cursor, nil
+}
+
+// nextCursor 下一页游标：keyset记录末行键值，否则记录偏移
+func nextCursor(cursor pageCursor, size int, keys []string, valueOf func(key string) (any, bool)) (string, error) {
+	next := pageCursor{Offset: cursor.Offset + size}
+	if len(keys) > 0 {
+		next = pageCursor{Keys: make([]any, len(keys))}
+		for i, key := range keys {
+			val, ok := valueOf(key)
+			if !ok {
+				return "", fmt.Errorf("dbx: page key %v not in result", key)
+			}
+			// MySQL的字符串列(文本协议下所有列)扫描为[]byte，按JSON编码会变成base64文本
+			if data, ok := val.([]byte); ok {
+				val = string(data)
+			}
+			next.Keys[i] = val
+		}
+	}
+	return encodeCursor(next)
+}
+
+// pageKeys 解析"-col"形式的排序键，并校验游标与排序键匹配
+func pageKeys(orderBy []string, cursor pageCursor) ([]string, []bool, error) {
+	keys := make([]string, len(orderBy))
+	descs := make([]bool, len(orderBy))
+	for i, col := range orderBy {
+		descs[i] = strings.HasPrefix(col, "-")
+		keys[i] = strings.TrimPrefix(strings.TrimPrefix(col, "-"), "+")
+		if !IsIdent(keys[i]) || strings.Contains(keys[i], ".") {
+			return nil, nil, fmt.Errorf("dbx: bad page key %q", col)
+		}
+	}
+	if len(cursor.Keys) > 0 && len(cursor.Keys) != len(keys) {
+		return nil, nil, fmt.Errorf("dbx: cursor does not match order by %v", orderBy)
+	}
+	return keys, descs, nil
+}
+
+// keysetCond 展开为 (k1 > v1) OR (k1 = v1 AND k2 > v2) ...，不依赖行值比较语法
+func keysetCond(r *render, keys []string, descs []bool, vals []any) string {
+	ors := make([]string, len(keys))
+	for i := range keys {
+		ands := make([]string, 0, i+1)
+		for j := 0; j <= i; j++ {
+			op := "="
+			if j == i {
+				op = gox.IfElse(descs[j], "<", ">").(string)
+			}
+			ands = append(ands, r.d.Quote(keys[j])+" "+op+" "+r.arg(vals[j]))
+		}
+		ors[i] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// encodeCursor 编码为base64url游标，可直接放入URL查询参数而无需转义
+func encodeCursor(cursor pageCursor) (string, error) {
+	for i, val := range cursor.Keys {
+		if t, ok := val.(time.Time); ok {
+			cursor.Keys[i] = map[string]string{"$t": t.Format(time.RFC3339Nano)}
+		}
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("dbx: encode cursor: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor 解析游标，空串为第一页；整数键值还原为int64，时间还原为time.Time
+func decodeCursor(token string) (pageCursor, error) {
+	var cursor pageCursor
+	if token == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(token, "="))
+	if err != nil {
+		return cursor, fmt.Errorf("dbx: bad cursor: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&cursor); err != nil {
+		return cursor, fmt.Errorf("dbx: bad cursor: %v", err)
+	}
+	for i, val := range cursor.Keys {
+		switch v := val.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				cursor.Keys[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				cursor.Keys[i] = f
+			}
+		case map[string]any:
+			// 时间键值编码为{"$t": RFC3339}
+			t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v["$t"]))
+			if err != nil {
+				return cursor, fmt.Errorf("dbx: bad cursor time: %v", err)
+			}
+			cursor.Keys[i] = t
+		}
+	}
+	if cursor.Offset < 0 {
+		return cursor, fmt.Errorf("dbx: bad cursor offset %d", cursor.Offset)
+	}
+	return cursor, nil
+}
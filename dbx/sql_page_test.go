@@ -0,0 +1,98 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeysetSQL(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeQuery{rows: []*jsonx.JObj{{"created_at": 5, "id": 9}, {"created_at": 5, "id": 8}}}
+	req := PageReq{Size: 1, OrderBy: []string{"-created_at", "-id"}}
+	page, err := Paginate(ctx, db, "SELECT * FROM orders WHERE shop_id = $1;", req, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM orders WHERE shop_id = $1) AS _dbx_page ORDER BY "created_at" DESC, "id" DESC LIMIT 2`, db.execs[0])
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Rows, 1)
+
+	req.Cursor = page.NextCursor
+	_, err = Paginate(ctx, db, "SELECT * FROM orders WHERE shop_id = $1", req, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM orders WHERE shop_id = $1) AS _dbx_page `+
+		`WHERE (("created_at" < $2) OR ("created_at" = $3 AND "id" < $4)) ORDER BY "created_at" DESC, "id" DESC LIMIT 2`, db.execs[1])
+	assert.Equal(t, []any{7, int64(5), int64(5), int64(9)}, db.args[1])
+
+	// 时间键经游标往返后仍为time.Time
+	at := time.Date(2024, 1, 2, 3, 4, 5, 678, time.UTC)
+	db = &fakeQuery{rows: []*jsonx.JObj{{"created_at": at, "id": 9}, {"created_at": at, "id": 8}}}
+	page, err = Paginate(ctx, db, "SELECT * FROM orders", PageReq{Size: 1, OrderBy: []string{"created_at", "id"}})
+	assert.NoError(t, err)
+	_, err = Paginate(ctx, db, "SELECT * FROM orders", PageReq{Size: 1, Cursor: page.NextCursor, OrderBy: []string{"created_at", "id"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []any{at, at, int64(9)}, db.args[1])
+
+	// MySQL以[]byte返回字符串键，游标中须还原为文本而不是base64
+	db = &fakeQuery{d: DialectMySQL, rows: []*jsonx.JObj{{"code": []byte("b-1"), "id": []byte("9")}, {"code": []byte("b-2"), "id": []byte("8")}}}
+	page, err = Paginate(ctx, db, "SELECT * FROM orders", PageReq{Size: 1, OrderBy: []string{"code"}})
+	assert.NoError(t, err)
+	_, err = Paginate(ctx, db, "SELECT * FROM orders", PageReq{Size: 1, Cursor: page.NextCursor, OrderBy: []string{"code"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM orders) AS _dbx_page WHERE ((`code` > ?)) ORDER BY `code` ASC LIMIT 2", db.execs[1])
+	assert.Equal(t, []any{"b-1"}, db.args[1])
+
+	// 游标与排序键不匹配、非法游标、非法键
+	req.OrderBy = []string{"id"}
+	_, err = Paginate(ctx, db, "SELECT * FROM orders", req)
+	assert.Error(t, err)
+	_, err = Paginate(ctx, db, "SELECT * FROM orders", PageReq{Cursor: "!!"})
+	assert.Error(t, err)
+	_, err = Paginate(ctx, db, "SELECT * FROM orders", PageReq{OrderBy: []string{"id; DROP"}})
+	assert.Error(t, err)
+}
+
+func TestPaginateSQLite(t *testing.T) {
+	ctx := context.Background()
+	db := NewSQLite("page", &jsonx.JObj{"db_url": "sqlite://:memory:"})
+	assert.NoError(t, db.Connect(ctx))
+	defer db.Close(ctx)
+	_, err := db.Exec(ctx, "CREATE TABLE items (id INTEGER PRIMARY KEY, grp INTEGER, name TEXT)")
+	assert.NoError(t, err)
+	rows := make([][]any, 0)
+	for i := 1; i <= 7; i++ {
+		rows = append(rows, []any{i, i % 2, "item"})
+	}
+	_, err = db.BulkInsert(ctx, "items", []string{"id", "grp", "name"}, rows)
+	assert.NoError(t, err)
+
+	// keyset: 按(grp, id)续读直到末页
+	ids := make([]int, 0)
+	req := PageReq{Size: 3, WithTotal: true, OrderBy: []string{"grp", "id"}}
+	for {
+		page, err := Paginate(ctx, db, "SELECT id, grp FROM items WHERE name = ?", req, "item")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), page.Total)
+		for _, row := range page.Rows {
+			ids = append(ids, row.GetInt("id"))
+		}
+		if !page.HasMore {
+			assert.Empty(t, page.NextCursor)
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []int{2, 4, 6, 1, 3, 5, 7}, ids)
+
+	// offset: 页码跳页后以游标续读
+	page, err := Paginate(ctx, db, "SELECT id FROM items ORDER BY id", PageReq{Size: 2, Page: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), page.Total)
+	assert.Equal(t, 3, page.Rows[0].GetInt("id"))
+	page, err = Paginate(ctx, db, "SELECT id FROM items ORDER BY id", PageReq{Size: 2, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, page.Rows[0].GetInt("id"))
+}
@@ -0,0 +1,221 @@
+package dbx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+	"github.com/fengzhi09/golibx/logx"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxNotifyPayload PostgreSQL通知载荷上限(字节)
+const maxNotifyPayload = 8000
+
+// Notification PostgreSQL通知
+type Notification struct {
+	Channel string
+	Payload jsonx.JObj // JSON对象载荷；非JSON对象时为{"payload": 原文}
+	Raw     string
+	PID     uint32 // 发送方后端进程ID
+	// Reconnected 重连并重新LISTEN后为每个频道补发一次，Payload为空；断线期间的通知已丢失，收到后应重新同步状态
+	Reconnected bool
+}
+
+// NotifyHandler 通知回调，在监听协程中顺序调用；重连后会收到Reconnected通知
+type NotifyHandler func(ctx context.Context, n *Notification)
+
+// PgListener 使用独立的pgx连接LISTEN频道，连接断开后按退避自动重连并重新LISTEN
+type PgListener struct {
+	name     string
+	cfg      *pgx.ConnConfig
+	channels []string
+	handler  NotifyHandler
+	backoff  time.Duration
+	mutex    sync.Mutex
+	conn     *pgx.Conn
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewPgListener 创建监听器；conf同PostgreSQL连接配置，listen_backoff_sec为重连退避上限(默认30)
+func NewPgListener(name string, conf DBConf, handler NotifyHandler, channels ...string) (*PgListener, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("dbx: listener %v has no handler", name)
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("dbx: listener %v has no channel", name)
+	}
+	for _, channel := range channels {
+		if !IsIdent(channel) || strings.Contains(channel, ".") {
+			return nil, fmt.Errorf("dbx: bad channel name %q", channel)
+		}
+	}
+	cfg, err := (&PSql{}).PoolConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return &PgListener{
+		name:     name,
+		cfg:      cfg.ConnConfig.Copy(),
+		channels: channels,
+		handler:  handler,
+		backoff:  time.Duration(getIntOr(conf, "listen_backoff_sec", 30)) * time.Second,
+	}, nil
+}
+
+// Start 建立连接并LISTEN，随后在后台接收通知；首次连接失败直接返回错误
+func (l *PgListener) Start(ctx context.Context) error {
+	if l.done != nil {
+		return fmt.Errorf("dbx: listener %v already started", l.name)
+	}
+	if err := l.connect(ctx); err != nil {
+		return err
+	}
+	ctx, l.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	l.done = make(chan struct{})
+	go l.loop(ctx)
+	return nil
+}
+
+// connect 建立连接并LISTEN所有频道
+func (l *PgListener) connect(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, l.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	for _, channel := range l.channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+DialectPostgres.Quote(channel)); err != nil {
+			conn.Close(ctx)
+			return fmt.Errorf("failed to listen %v: %w", channel, err)
+		}
+	}
+	l.mutex.Lock()
+	l.conn = conn
+	l.mutex.Unlock()
+	return nil
+}
+
+// current 当前连接，重连时由connect替换
+func (l *PgListener) current() *pgx.Conn {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.conn
+}
+
+// loop 接收通知，出错时关闭连接并退避重连
+func (l *PgListener) loop(ctx context.Context) {
+	defer close(l.done)
+	wait := time.Second
+	for {
+		conn := l.current()
+		n, err := conn.WaitForNotification(ctx)
+		if err == nil {
+			wait = time.Second
+			l.handler(ctx, decodeNotification(n.Channel, n.Payload, n.PID))
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logx.WarnfM(ctx, "dbx", "监听 %s 连接断开: %v", l.name, err)
+		conn.Close(context.Background())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait = min(wait*2, l.backoff)
+			if err := l.connect(ctx); err != nil {
+				logx.WarnfM(ctx, "dbx", "监听 %s 重连失败: %v", l.name, err)
+				continue
+			}
+			logx.InfofM(ctx, "dbx", "监听 %s 重连成功", l.name)
+			l.notifyReconnected(ctx)
+			break
+		}
+	}
+}
+
+// notifyReconnected 为每个频道补发Reconnected通知，告知调用方断线期间的通知已丢失
+func (l *PgListener) notifyReconnected(ctx context.Context) {
+	for _, channel := range l.channels {
+		l.handler(ctx, &Notification{Channel: channel, Payload: jsonx.JObj{}, Reconnected: true})
+	}
+}
+
+// decodeNotification 解析JSON对象载荷
+func decodeNotification(channel, payload string, pid uint32) *Notification {
+	n := &Notification{Channel: channel, Raw: payload, PID: pid}
+	if err := json.Unmarshal([]byte(payload), &n.Payload); err != nil || n.Payload == nil {
+		n.Payload = jsonx.JObj{"payload": payload}
+	}
+	return n
+}
+
+// Close 停止监听并关闭连接
+func (l *PgListener) Close(ctx context.Context) error {
+	if l.cancel == nil {
+		return nil
+	}
+	l.cancel()
+	<-l.done
+	l.cancel = nil
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.conn.Close(ctx)
+}
+
+// Notify 向频道发送通知；payload为字符串时原样发送，否则编码为JSON
+func Notify(ctx context.Context, db IQuery, channel string, payload any) error {
+	if db.Dialect() != DialectPostgres {
+		return fmt.Errorf("dbx: notify requires postgres, got %v", db.Dialect())
+	}
+	text, ok := payload.(string)
+	if !ok {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("dbx: encode notify payload: %v", err)
+		}
+		text = string(data)
+	}
+	if len(text) >= maxNotifyPayload {
+		return fmt.Errorf("dbx: notify payload too large: %d bytes", len(text))
+	}
+	_, err := db.Exec(ctx, "SELECT pg_notify($1, $2)", channel, text)
+	return err
+}
+
+// Listen 为已初始化的PostgreSQL库创建并启动监听器，读写分离时连接主库；CloseAll时关闭
+func (dm *DBMgr) Listen(ctx context.Context, name string, handler NotifyHandler, channels ...string) (*PgListener, error) {
+	dm.mutex.RLock()
+	conf, ok := dm.confMap[name]
+	dm.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("database %s not found", name)
+	}
+	if conf.Contains("replicas") {
+		conf = routeConf(conf, conf.GetObj("primary"))
+	}
+	if dbType, err := dm.detectDBType(conf); err != nil || DialectOf(dbType) != DialectPostgres {
+		return nil, fmt.Errorf("dbx: listen requires postgres database, %s is %v", name, dbType)
+	}
+	l, err := NewPgListener(name, conf, handler, channels...)
+	if err != nil {
+		return nil, err
+	}
+	// 连接期间不持有锁，避免网络阻塞其他库的Use
+	if err := l.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to listen on database %s: %v", name, err)
+	}
+	dm.mutex.Lock()
+	dm.listeners = append(dm.listeners, l)
+	dm.mutex.Unlock()
+	return l, nil
+}
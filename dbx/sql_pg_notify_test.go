@@ -0,0 +1,91 @@
+package dbx
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeQuery{}
+	assert.NoError(t, Notify(ctx, db, "cache_invalidate", jsonx.JObj{"key": "user:1"}))
+	assert.Equal(t, "SELECT pg_notify($1, $2)", db.execs[0])
+	assert.Equal(t, []any{"cache_invalidate", `{"key":"user:1"}`}, db.args[0])
+	assert.NoError(t, Notify(ctx, db, "raw", "plain"))
+	assert.Equal(t, []any{"raw", "plain"}, db.args[1])
+	assert.Error(t, Notify(ctx, db, "big", strings.Repeat("x", maxNotifyPayload)))
+	assert.Error(t, Notify(ctx, &fakeQuery{d: DialectMySQL}, "c", "x"))
+
+	n := decodeNotification("c", `{"key":"user:1","n":2}`, 42)
+	assert.Equal(t, "user:1", n.Payload.GetStr("key"))
+	assert.Equal(t, 2, n.Payload.GetInt("n"))
+	assert.Equal(t, uint32(42), n.PID)
+	n = decodeNotification("c", "user:1", 42)
+	assert.Equal(t, jsonx.JObj{"payload": "user:1"}, n.Payload)
+	assert.Equal(t, "user:1", n.Raw)
+
+	handler := func(ctx context.Context, n *Notification) {}
+	_, err := NewPgListener("main", &jsonx.JObj{}, handler)
+	assert.ErrorContains(t, err, "no channel")
+	_, err = NewPgListener("main", &jsonx.JObj{}, handler, "bad;channel")
+	assert.ErrorContains(t, err, "bad channel")
+	_, err = NewPgListener("main", &jsonx.JObj{}, nil, "c")
+	assert.ErrorContains(t, err, "no handler")
+
+	dm := &DBMgr{dbMap: map[string]ISQL{}, confMap: map[string]DBConf{"local": &jsonx.JObj{"db_url": "sqlite://:memory:"}}}
+	_, err = dm.Listen(ctx, "local", handler, "c")
+	assert.Error(t, err)
+}
+
+func TestListenerReconnected(t *testing.T) {
+	ctx := context.Background()
+	var got []*Notification
+	l, err := NewPgListener("main", &jsonx.JObj{}, func(ctx context.Context, n *Notification) { got = append(got, n) }, "a", "b")
+	assert.NoError(t, err)
+	l.notifyReconnected(ctx)
+	assert.Equal(t, []*Notification{
+		{Channel: "a", Payload: jsonx.JObj{}, Reconnected: true},
+		{Channel: "b", Payload: jsonx.JObj{}, Reconnected: true},
+	}, got)
+}
+
+func TestListenUnlocked(t *testing.T) {
+	// 接受连接但不应答的服务端，使连接阻塞到超时
+	srv, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer srv.Close()
+	go func() {
+		for {
+			conn, err := srv.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	dm := &DBMgr{dbMap: map[string]ISQL{"other": &fakeSQL{fakeQuery: &fakeQuery{}}}, confMap: map[string]DBConf{
+		"main": &jsonx.JObj{"db_url": "postgres://u@" + srv.Addr().String() + "/db"}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := dm.Listen(ctx, "main", func(ctx context.Context, n *Notification) {}, "c")
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 连接期间其他库仍可使用
+	start := time.Now()
+	_, err = dm.Use("other")
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Error(t, <-done)
+	assert.Empty(t, dm.listeners)
+}
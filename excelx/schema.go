@@ -0,0 +1,111 @@
+package excelx
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/fengzhi09/golibx/dbx"
+	"github.com/fengzhi09/golibx/jsonx"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// schemaTypes 数据库归一化类型到字段输出类型
+var schemaTypes = map[string]FieldType{
+	dbx.TypeInt:      FT_Int,
+	dbx.TypeFloat:    FT_Float,
+	dbx.TypeDecimal:  FT_Float,
+	dbx.TypeBool:     FT_Bool,
+	dbx.TypeDate:     FT_Date,
+	dbx.TypeTime:     FT_Time,
+	dbx.TypeDateTime: FT_DateTime,
+	dbx.TypeArray:    FT_StringArray,
+}
+
+// MapperFromColumns 由表结构生成默认映射：列名为标准名、列注释为表头别名，非空且无默认值的列为必填，自增列跳过
+func MapperFromColumns(columns []dbx.Column) *MapperConf {
+	mapper := &MapperConf{Mappers: []FieldConf{}, Required: []string{}}
+	for _, col := range columns {
+		if col.AutoIncr {
+			continue
+		}
+		field := FieldConf{StdName: col.Name, OutputType: FT_String}
+		if ft, hit := schemaTypes[col.Type]; hit {
+			field.OutputType = ft
+		}
+		if col.Comment != "" {
+			field.Alias = []string{col.Comment}
+		}
+		mapper.Mappers = append(mapper.Mappers, field)
+		if !col.Nullable && col.Default == "" {
+			mapper.Required = append(mapper.Required, col.Name)
+		}
+	}
+	return mapper
+}
+
+// MapperFromTable 读取表结构生成默认映射
+func MapperFromTable(ctx context.Context, db dbx.ISchema, table string) (*MapperConf, error) {
+	columns, err := db.Columns(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	return MapperFromColumns(columns), nil
+}
+
+// XlsxEach 先写表头，返回将行按columns顺序追加到sheet的回调，用于dbx.QueryEach流式导出
+func XlsxEach(sw *excelize.StreamWriter, columns []string) (func(row *jsonx.JObj) error, error) {
+	if err := sw.SetRow("A1", StringS2InterfaceS(columns)); err != nil {
+		return nil, err
+	}
+	rowNum := 1
+	return func(row *jsonx.JObj) error {
+		rowNum++
+		cells := make([]any, len(columns))
+		for i, col := range columns {
+			cells[i] = xlsxCell((*row)[col])
+		}
+		axis, err := excelize.CoordinatesToCellName(1, rowNum)
+		if err != nil {
+			return err
+		}
+		return sw.SetRow(axis, cells)
+	}, nil
+}
+
+// QueryToXlsx 流式查询并写入新建文件的Sheet1，首行为columns；返回的文件由调用方Release
+func QueryToXlsx(ctx context.Context, db dbx.IQuery, query string, args []any, columns []string) (*XlsxFile, error) {
+	file := excelize.NewFile()
+	sw, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	each, err := XlsxEach(sw, columns)
+	if err == nil {
+		err = db.QueryEach(ctx, query, args, each)
+	}
+	if err == nil {
+		err = sw.Flush()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &XlsxFile{File: file}, nil
+}
+
+// xlsxCell 驱动原始值转为单元格值，数字与时间保留原类型
+func xlsxCell(raw any) any {
+	switch v := raw.(type) {
+	case []byte:
+		return string(v)
+	case driver.Valuer:
+		val, err := v.Value()
+		if err != nil {
+			return nil
+		}
+		return xlsxCell(val)
+	}
+	return raw
+}
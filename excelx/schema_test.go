@@ -0,0 +1,66 @@
+package excelx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/fengzhi09/golibx/dbx"
+	"github.com/fengzhi09/golibx/jsonx"
+)
+
+func TestMapperFromColumns(t *testing.T) {
+	columns := []dbx.Column{
+		{Name: "id", Type: dbx.TypeInt, AutoIncr: true, PrimaryKey: true},
+		{Name: "no", Type: dbx.TypeString, Comment: "订单号"},
+		{Name: "amount", Type: dbx.TypeDecimal, Nullable: true, Comment: "金额"},
+		{Name: "paid", Type: dbx.TypeBool, Default: "0"},
+		{Name: "created_at", Type: dbx.TypeDateTime},
+	}
+	mapper := MapperFromColumns(columns)
+	if len(mapper.Mappers) != 4 {
+		t.Fatalf("自增列应跳过: %v", mapper.Mappers)
+	}
+	if mapper.Mappers[1].OutputType != FT_Float || mapper.Mappers[3].OutputType != FT_DateTime {
+		t.Fatalf("类型映射错误: %v", mapper.Mappers)
+	}
+	if !NameMatch("订单号", "no", mapper.Mappers[0].Alias) {
+		t.Fatalf("列注释应作为别名: %v", mapper.Mappers[0])
+	}
+	if len(mapper.Required) != 2 || mapper.Required[0] != "no" || mapper.Required[1] != "created_at" {
+		t.Fatalf("必填列错误: %v", mapper.Required)
+	}
+}
+
+func TestQueryToXlsx(t *testing.T) {
+	ctx := context.Background()
+	db := dbx.NewSQLite("export", &jsonx.JObj{"db_url": "sqlite://:memory:"})
+	if err := db.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close(ctx)
+	if _, err := db.Exec(ctx, "CREATE TABLE users (id INTEGER, name TEXT, score REAL)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "INSERT INTO users VALUES (1, 'tom', 9.5), (2, 'jerry', NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := QueryToXlsx(ctx, db, "SELECT id, name, score FROM users ORDER BY id", nil, []string{"name", "score", "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Release(ctx)
+	rows, err := file.GetRows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"name", "score", "id"}, {"tom", "9.5", "1"}, {"jerry", "", "2"}}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("导出内容错误: %v", rows)
+	}
+
+	if _, err := QueryToXlsx(ctx, db, "SELECT * FROM missing", nil, []string{"id"}); err == nil {
+		t.Fatal("查询失败应返回错误")
+	}
+}
@@ -218,3 +218,29 @@ func (re *MemEventBus) Start() {
 		}()
 	}
 }
+
+// PgReconnected 监听重连后在各频道发布的事件数据；断线期间的通知已丢失，订阅者应重新同步状态
+type PgReconnected struct {
+	Channel string
+}
+
+// PgEventHandler 将PostgreSQL通知转为MemEvent发布到bus：Type为频道名，Data为jsonx.JObj载荷，重连时为PgReconnected；
+// bus启用异步队列时异步发布，避免阻塞监听连接
+func PgEventHandler(bus *MemEventBus) dbx.NotifyHandler {
+	return func(ctx context.Context, n *dbx.Notification) {
+		event := &MemEvent{Id: dbx.NewOID(), Type: n.Channel, Data: n.Payload}
+		if n.Reconnected {
+			event.Data = PgReconnected{Channel: n.Channel}
+		}
+		if bus.AsyncEnable() {
+			bus.PubAsync(ctx, event)
+		} else {
+			bus.PubSync(ctx, event)
+		}
+	}
+}
+
+// ListenPgEvents 监听dbx.DB()中名为name的PostgreSQL库的频道，并将通知桥接到bus
+func ListenPgEvents(ctx context.Context, name string, bus *MemEventBus, channels ...string) (*dbx.PgListener, error) {
+	return dbx.DB().Listen(ctx, name, PgEventHandler(bus), channels...)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/fengzhi09/golibx/dbx"
+	"github.com/fengzhi09/golibx/jsonx"
 	"testing"
 	"time"
 )
@@ -59,3 +60,25 @@ func TestEventBus(t *testing.T) {
 	bus1.Close()
 	t.Logf("All done")
 }
+
+func TestPgEventHandler(t *testing.T) {
+	bus := NewEventBus("pg", 0, nil)
+	got := make([]*MemEvent, 0)
+	bus.Sub("cache", func(ctx context.Context, step EventStep, event *MemEvent) error {
+		got = append(got, event)
+		return nil
+	}, AcceptTypes("cache_invalidate"))
+	handle := PgEventHandler(bus)
+	handle(context.Background(), &dbx.Notification{Channel: "cache_invalidate", Payload: jsonx.JObj{"key": "user:1"}})
+	handle(context.Background(), &dbx.Notification{Channel: "other", Payload: jsonx.JObj{}})
+	if len(got) != 1 {
+		t.Fatalf("got %v events, want 1", len(got))
+	}
+	if data, ok := got[0].Data.(jsonx.JObj); !ok || data.GetStr("key") != "user:1" || got[0].Id.IsEmpty() {
+		t.Errorf("bad event: %+v", got[0])
+	}
+	handle(context.Background(), &dbx.Notification{Channel: "cache_invalidate", Payload: jsonx.JObj{}, Reconnected: true})
+	if len(got) != 2 || got[1].Data != (PgReconnected{Channel: "cache_invalidate"}) {
+		t.Errorf("bad reconnect event: %+v", got[len(got)-1])
+	}
+}
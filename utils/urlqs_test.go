@@ -230,3 +230,21 @@ func TestStructUnmarshalForm(t *testing.T) {
 	err = structUnmarshalForm(values, nilPtr)
 	assert.Error(t, err)
 }
+
+// 测试分页游标经QueryString往返
+func TestQueryStringCursor(t *testing.T) {
+	type pageQuery struct {
+		Cursor string `query:"cursor"`
+	}
+	cursor := "eyJrIjpbOV19"
+	qs, err := NewQueryString(pageQuery{Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Equal(t, QueryString("cursor="+cursor), qs)
+
+	// 缺失的参数重置为空串
+	got := pageQuery{Cursor: "old"}
+	assert.NoError(t, qs.Bind(&got))
+	assert.Equal(t, cursor, got.Cursor)
+	assert.NoError(t, QueryString("size=10").Bind(&got))
+	assert.Empty(t, got.Cursor)
+}